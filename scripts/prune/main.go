@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Aleksao998/Merkle-Patricia-Trie/state"
+	"github.com/Aleksao998/Merkle-Patricia-Trie/storage/pebble"
+	"github.com/Aleksao998/Merkle-Patricia-Trie/trie"
+)
+
+var (
+	errResumeWithRoots = errors.New("-resume can not be combined with -root, " +
+		"an interrupted prune is resumed with the roots it was started with")
+	errRecentWithoutHead = errors.New("-keep-recent requires -keep-head")
+)
+
+// rootsFlag collects the roots given with repeated -root flags
+type rootsFlag [][]byte
+
+func (r *rootsFlag) String() string {
+	roots := make([]string, 0, len(*r))
+
+	for _, root := range *r {
+		roots = append(roots, hex.EncodeToString(root))
+	}
+
+	return strings.Join(roots, ",")
+}
+
+func (r *rootsFlag) Set(value string) error {
+	root, err := hex.DecodeString(strings.TrimPrefix(value, "0x"))
+	if err != nil {
+		return fmt.Errorf("invalid root %q: %w", value, err)
+	}
+
+	*r = append(*r, root)
+
+	return nil
+}
+
+func main() {
+	var roots rootsFlag
+
+	path := flag.String("db", "", "path of the Pebble database to prune")
+	keepHead := flag.Bool("keep-head", true, "keep the roots the default and the named tries of the database point to")
+	keepRecent := flag.Int("keep-recent", 0, "with -keep-head, also keep up to this number of most recent roots "+
+		"of the tries committed with a root history")
+	isState := flag.Bool("state", false, "the database holds an Ethereum state, keep the storage tries of its accounts")
+	resume := flag.Bool("resume", false, "resume an interrupted prune with the roots it was started with")
+	flag.Var(&roots, "root", "hex encoded root to keep, can be repeated")
+	flag.Parse()
+
+	if *path == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(*path, roots, *keepHead, *keepRecent, *isState, *resume); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(path string, roots [][]byte, keepHead bool, keepRecent int, isState, resume bool) error {
+	switch {
+	case resume && len(roots) > 0:
+		return errResumeWithRoots
+	case keepRecent > 0 && !keepHead && !resume:
+		return errRecentWithoutHead
+	}
+
+	db, err := pebble.NewStorage(path)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	switch {
+	case resume:
+		roots = nil
+	case keepHead:
+		heads, err := trie.HeadRoots(db, keepRecent)
+		if err != nil {
+			return err
+		}
+
+		if keepRecent > 0 {
+			// the recent roots are only recorded by the tries committed with trie.WithRootHistory
+			onlyHeads, err := trie.HeadRoots(db, 0)
+			if err != nil {
+				return err
+			}
+
+			if len(heads) == len(onlyHeads) {
+				fmt.Fprintln(os.Stderr, "warning: no recent roots found besides the heads, "+
+					"-keep-recent only applies to tries committed with trie.WithRootHistory")
+			}
+		}
+
+		roots = append(roots, heads...)
+	}
+
+	// the account leaves of a state reference the roots of their storage tries
+	var leaves trie.LeafReferences
+	if isState {
+		leaves = state.StorageRoots
+	}
+
+	progress, err := trie.Prune(db, roots, leaves, func(progress trie.PruneProgress) {
+		fmt.Printf("marked %d nodes, scanned %d keys, deleted %d nodes, reclaimed %d bytes\n",
+			progress.Marked, progress.Scanned, progress.Deleted, progress.Reclaimed)
+	})
+	if err != nil {
+		return fmt.Errorf("prune failed, run it again with -resume to resume it: %w", err)
+	}
+
+	fmt.Printf("pruning done: deleted %d nodes and reclaimed %d bytes\n", progress.Deleted, progress.Reclaimed)
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package state
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/Aleksao998/Merkle-Patricia-Trie/trie"
+	"github.com/Aleksao998/Merkle-Patricia-Trie/trie/crypto"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+var (
+	// emptyRoot is the root of an empty storage trie
+	emptyRoot = common.BytesToHash(trie.EmptyRootHash)
+
+	// emptyCodeHash is the code hash of an account without code
+	emptyCodeHash = crypto.Keccak256(nil)
+)
+
+// Account is the consensus representation of an account, stored RLP-encoded in the account trie
+type Account struct {
+	Nonce    uint64
+	Balance  *big.Int
+	Root     common.Hash // root of the storage trie
+	CodeHash []byte
+}
+
+// newAccount returns an account without balance, storage or code
+func newAccount() *Account {
+	return &Account{
+		Balance:  new(big.Int),
+		Root:     emptyRoot,
+		CodeHash: emptyCodeHash,
+	}
+}
+
+// decodeAccount decodes an RLP-encoded account
+func decodeAccount(data []byte) (*Account, error) {
+	account := new(Account)
+	if err := rlp.DecodeBytes(data, account); err != nil {
+		return nil, fmt.Errorf("failed to decode account: %w", err)
+	}
+
+	return account, nil
+}
+
+// StorageRoots returns the root of the storage trie held by an account leaf of the state trie,
+// so pruning and reference counting keep the storage tries of the kept accounts, see
+// trie.LeafReferences. Other values, like the storage slots, reference no trie
+func StorageRoots(value []byte) [][]byte {
+	account, err := decodeAccount(value)
+	if err != nil || account.Root == emptyRoot {
+		return nil
+	}
+
+	return [][]byte{account.Root.Bytes()}
+}
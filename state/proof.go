@@ -0,0 +1,200 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/Aleksao998/Merkle-Patricia-Trie/storage"
+	"github.com/Aleksao998/Merkle-Patricia-Trie/trie"
+	"github.com/Aleksao998/Merkle-Patricia-Trie/trie/crypto"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// AccountResult is the response of eth_getProof, in the JSON shape of EIP-1186
+type AccountResult struct {
+	Address      common.Address  `json:"address"`
+	AccountProof *trie.Proof     `json:"accountProof"`
+	Balance      *hexutil.Big    `json:"balance"`
+	CodeHash     common.Hash     `json:"codeHash"`
+	Nonce        hexutil.Uint64  `json:"nonce"`
+	StorageHash  common.Hash     `json:"storageHash"`
+	StorageProof []StorageResult `json:"storageProof"`
+}
+
+// StorageResult is the proof of a storage slot in the response of eth_getProof
+type StorageResult struct {
+	Key   common.Hash  `json:"key"`
+	Value *hexutil.Big `json:"value"`
+	Proof *trie.Proof  `json:"proof"`
+}
+
+// GetProof returns the proof of the account and of its storage slots in the state with the given root.
+// Missing accounts and slots are proven absent and reported with zero values
+func GetProof(root common.Hash, db storage.Storage, addr common.Address, slots []common.Hash) (*AccountResult, error) {
+	s, err := New(root, db)
+	if err != nil {
+		return nil, err
+	}
+
+	accountProof, err := s.accounts.ProofList(addr.Bytes())
+	if err != nil && !errors.Is(err, trie.ErrKeyNotFound) {
+		return nil, fmt.Errorf("failed to prove account %s: %w", addr, err)
+	}
+
+	object, err := s.getObject(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// a missing account is reported as an empty one
+	account := newAccount()
+	if object != nil {
+		account = object.account
+	}
+
+	result := &AccountResult{
+		Address:      addr,
+		AccountProof: accountProof,
+		Balance:      (*hexutil.Big)(account.Balance),
+		CodeHash:     common.BytesToHash(account.CodeHash),
+		Nonce:        hexutil.Uint64(account.Nonce),
+		StorageHash:  account.Root,
+		StorageProof: make([]StorageResult, 0, len(slots)),
+	}
+
+	for _, slot := range slots {
+		storageResult, err := s.proveSlot(object, slot)
+		if err != nil {
+			return nil, err
+		}
+
+		result.StorageProof = append(result.StorageProof, storageResult)
+	}
+
+	return result, nil
+}
+
+// proveSlot returns the proof of a storage slot of the account, which may be missing
+func (s *StateDB) proveSlot(object *stateObject, slot common.Hash) (StorageResult, error) {
+	result := StorageResult{
+		Key:   slot,
+		Value: new(hexutil.Big),
+		Proof: &trie.Proof{},
+	}
+
+	if object == nil {
+		return result, nil
+	}
+
+	storageTrie, err := s.storageTrie(object)
+	if err != nil {
+		return StorageResult{}, err
+	}
+
+	proof, err := storageTrie.ProofList(slot.Bytes())
+	if err != nil && !errors.Is(err, trie.ErrKeyNotFound) {
+		return StorageResult{}, fmt.Errorf("failed to prove storage slot %x: %w", slot, err)
+	}
+
+	value, err := s.getState(object, slot)
+	if err != nil {
+		return StorageResult{}, err
+	}
+
+	result.Value = (*hexutil.Big)(value.Big())
+	result.Proof = proof
+
+	return result, nil
+}
+
+// VerifyProof checks an eth_getProof response encoded in JSON against the state root and returns it.
+// The account fields and the slot values have to match the values proven by the proofs,
+// trie.ErrInvalidProof is returned otherwise
+func VerifyProof(root common.Hash, data []byte) (*AccountResult, error) {
+	result := new(AccountResult)
+	if err := json.Unmarshal(data, result); err != nil {
+		return nil, fmt.Errorf("%w: %w", trie.ErrInvalidProof, err)
+	}
+
+	if result.AccountProof == nil || result.Balance == nil {
+		return nil, fmt.Errorf("%w: missing account fields", trie.ErrInvalidProof)
+	}
+
+	accountData, err := trie.VerifyProof(
+		trieRoot(root),
+		crypto.Keccak256(result.Address.Bytes()),
+		result.AccountProof.Storage(),
+	)
+
+	// a missing account has to be reported as an empty one
+	account := newAccount()
+
+	switch {
+	case errors.Is(err, trie.ErrKeyAbsent):
+	case err != nil:
+		return nil, fmt.Errorf("failed to verify account %s: %w", result.Address, err)
+	default:
+		if account, err = decodeAccount(accountData); err != nil {
+			return nil, fmt.Errorf("%w: %w", trie.ErrInvalidProof, err)
+		}
+	}
+
+	if uint64(result.Nonce) != account.Nonce ||
+		result.Balance.ToInt().Cmp(account.Balance) != 0 ||
+		result.CodeHash != common.BytesToHash(account.CodeHash) ||
+		result.StorageHash != account.Root {
+		return nil, fmt.Errorf("%w: account %s does not match the proof", trie.ErrInvalidProof, result.Address)
+	}
+
+	for _, storageResult := range result.StorageProof {
+		if err := verifySlot(account.Root, storageResult); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// verifySlot checks the proof of a storage slot against the storage root
+func verifySlot(storageRoot common.Hash, result StorageResult) error {
+	if result.Proof == nil || result.Value == nil {
+		return fmt.Errorf("%w: missing fields of storage slot %x", trie.ErrInvalidProof, result.Key)
+	}
+
+	data, err := trie.VerifyProof(trieRoot(storageRoot), crypto.Keccak256(result.Key.Bytes()), result.Proof.Storage())
+
+	// a missing slot has to be reported as zero
+	value := new(big.Int)
+
+	switch {
+	case errors.Is(err, trie.ErrKeyAbsent):
+	case err != nil:
+		return fmt.Errorf("failed to verify storage slot %x: %w", result.Key, err)
+	default:
+		_, content, _, err := rlp.Split(data)
+		if err != nil {
+			return fmt.Errorf("%w: %w", trie.ErrInvalidProof, err)
+		}
+
+		value.SetBytes(content)
+	}
+
+	if result.Value.ToInt().Cmp(value) != 0 {
+		return fmt.Errorf("%w: storage slot %x does not match the proof", trie.ErrInvalidProof, result.Key)
+	}
+
+	return nil
+}
+
+// trieRoot returns the root hash of a trie as expected by the trie package, nil for the zero hash
+func trieRoot(root common.Hash) []byte {
+	if root == (common.Hash{}) {
+		return nil
+	}
+
+	return root.Bytes()
+}
@@ -0,0 +1,210 @@
+package state
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/Aleksao998/Merkle-Patricia-Trie/storage/mpt"
+	"github.com/Aleksao998/Merkle-Patricia-Trie/trie"
+	"github.com/Aleksao998/Merkle-Patricia-Trie/trie/crypto"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	ethereumState "github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ethereumProof collects the nodes of a go-ethereum proof in order
+type ethereumProof [][]byte
+
+func (p *ethereumProof) Put(key []byte, value []byte) error {
+	*p = append(*p, value)
+
+	return nil
+}
+
+func (p *ethereumProof) Delete(key []byte) error {
+	return nil
+}
+
+// TestGetProofMatchesEthereum tests that the account and storage proofs have the same
+// nodes as the ones of go-ethereum, for existing and missing accounts and slots
+func TestGetProofMatchesEthereum(t *testing.T) {
+	t.Parallel()
+
+	db := mpt.NewMPTMemoryStorage()
+
+	stateDB, err := New(common.Hash{}, db)
+	require.NoError(t, err)
+
+	ethereumDB := ethereumState.NewDatabase(rawdb.NewMemoryDatabase())
+	ethereumStateDB, err := ethereumState.New(types.EmptyRootHash, ethereumDB, nil)
+	require.NoError(t, err)
+
+	for addr, account := range stateTestAccounts() {
+		require.NoError(t, stateDB.SetNonce(addr, account.nonce))
+		require.NoError(t, stateDB.SetBalance(addr, account.balance))
+		ethereumStateDB.SetNonce(addr, account.nonce)
+		ethereumStateDB.SetBalance(addr, account.balance)
+
+		if account.code != nil {
+			require.NoError(t, stateDB.SetCode(addr, account.code))
+			ethereumStateDB.SetCode(addr, account.code)
+		}
+
+		for slot, value := range account.storage {
+			require.NoError(t, stateDB.SetState(addr, slot, value))
+			ethereumStateDB.SetState(addr, slot, value)
+		}
+	}
+
+	root, err := stateDB.Commit()
+	require.NoError(t, err)
+
+	ethereumRoot, err := ethereumStateDB.Commit(0, false)
+	require.NoError(t, err)
+	require.Equal(t, ethereumRoot, root)
+
+	accountTrie, err := ethereumDB.OpenTrie(root)
+	require.NoError(t, err)
+
+	slots := []common.Hash{
+		common.BigToHash(big.NewInt(0)),
+		common.BigToHash(big.NewInt(3)),
+		common.HexToHash("0xff"),
+	}
+
+	for _, addr := range []common.Address{
+		common.BigToAddress(big.NewInt(7)),
+		common.BigToAddress(big.NewInt(14)),
+		common.HexToAddress("0xdead"),
+	} {
+		result, err := GetProof(root, db, addr, slots)
+		require.NoError(t, err)
+
+		var expected ethereumProof
+		require.NoError(t, accountTrie.Prove(crypto.Keccak256(addr.Bytes()), &expected))
+		assert.Equal(t, [][]byte(expected), result.AccountProof.Nodes)
+
+		assert.Equal(t, ethereumStateDB.GetNonce(addr), uint64(result.Nonce))
+		assert.Equal(t, 0, ethereumStateDB.GetBalance(addr).Cmp(result.Balance.ToInt()))
+		require.Len(t, result.StorageProof, len(slots))
+
+		storageRoot := ethereumStateDB.GetStorageRoot(addr)
+		if storageRoot == (common.Hash{}) {
+			// missing account
+			assert.Equal(t, emptyRoot, result.StorageHash)
+			assert.Equal(t, common.BytesToHash(emptyCodeHash), result.CodeHash)
+		} else {
+			assert.Equal(t, storageRoot, result.StorageHash)
+			assert.Equal(t, ethereumStateDB.GetCodeHash(addr), result.CodeHash)
+		}
+
+		for i, slot := range slots {
+			storageResult := result.StorageProof[i]
+			assert.Equal(t, slot, storageResult.Key)
+			assert.Equal(t, 0, ethereumStateDB.GetState(addr, slot).Big().Cmp(storageResult.Value.ToInt()))
+
+			if storageRoot == (common.Hash{}) || storageRoot == emptyRoot {
+				assert.Empty(t, storageResult.Proof.Nodes)
+
+				continue
+			}
+
+			storageTrie, err := ethereumDB.OpenStorageTrie(root, addr, storageRoot)
+			require.NoError(t, err)
+
+			var expected ethereumProof
+			require.NoError(t, storageTrie.Prove(crypto.Keccak256(slot.Bytes()), &expected))
+			assert.Equal(t, [][]byte(expected), storageResult.Proof.Nodes)
+		}
+
+		data, err := json.Marshal(result)
+		require.NoError(t, err)
+
+		verified, err := VerifyProof(root, data)
+		require.NoError(t, err)
+		assert.Equal(t, result.Address, verified.Address)
+	}
+}
+
+// TestVerifyProof tests that responses not matching their proofs are rejected
+func TestVerifyProof(t *testing.T) {
+	t.Parallel()
+
+	db := mpt.NewMPTMemoryStorage()
+
+	stateDB, err := New(common.Hash{}, db)
+	require.NoError(t, err)
+
+	addr := common.HexToAddress("0x1234")
+	slot := common.HexToHash("0x01")
+
+	for i := int64(1); i <= 20; i++ {
+		require.NoError(t, stateDB.SetBalance(common.BigToAddress(big.NewInt(i)), big.NewInt(i)))
+		require.NoError(t, stateDB.SetState(addr, common.BigToHash(big.NewInt(i)), common.BigToHash(big.NewInt(i*10))))
+	}
+
+	require.NoError(t, stateDB.SetNonce(addr, 5))
+
+	root, err := stateDB.Commit()
+	require.NoError(t, err)
+
+	result, err := GetProof(root, db, addr, []common.Hash{slot})
+	require.NoError(t, err)
+
+	data, err := json.Marshal(result)
+	require.NoError(t, err)
+
+	// the response has the fields of EIP-1186
+	var fields map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(data, &fields))
+
+	for _, field := range []string{
+		"address", "accountProof", "balance", "codeHash", "nonce", "storageHash", "storageProof",
+	} {
+		assert.Contains(t, fields, field)
+	}
+
+	_, err = VerifyProof(root, data)
+	require.NoError(t, err)
+
+	_, err = VerifyProof(common.HexToHash("0x01"), data)
+	assert.ErrorIs(t, err, trie.ErrInvalidProof)
+
+	tamper := func(modify func(result *AccountResult)) []byte {
+		tampered, err := GetProof(root, db, addr, []common.Hash{slot})
+		require.NoError(t, err)
+
+		modify(tampered)
+
+		data, err := json.Marshal(tampered)
+		require.NoError(t, err)
+
+		return data
+	}
+
+	for name, modify := range map[string]func(result *AccountResult){
+		"nonce": func(result *AccountResult) {
+			result.Nonce++
+		},
+		"balance": func(result *AccountResult) {
+			result.Balance = (*hexutil.Big)(big.NewInt(100))
+		},
+		"storage hash": func(result *AccountResult) {
+			result.StorageHash = emptyRoot
+		},
+		"slot value": func(result *AccountResult) {
+			result.StorageProof[0].Value = (*hexutil.Big)(big.NewInt(11))
+		},
+		"missing slot value": func(result *AccountResult) {
+			result.StorageProof[0].Proof.Nodes = nil
+		},
+	} {
+		_, err := VerifyProof(root, tamper(modify))
+		assert.ErrorIs(t, err, trie.ErrInvalidProof, name)
+	}
+}
@@ -0,0 +1,382 @@
+// Package state implements the Ethereum account state on top of the Merkle Patricia Trie
+package state
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/Aleksao998/Merkle-Patricia-Trie/storage"
+	"github.com/Aleksao998/Merkle-Patricia-Trie/trie"
+	"github.com/Aleksao998/Merkle-Patricia-Trie/trie/crypto"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// codePrefix is the storage namespace of the contract code, keyed by code hash
+const codePrefix = "code-"
+
+// stateObject is an account loaded from the account trie, along with its storage trie
+type stateObject struct {
+	account *Account
+	storage *trie.SecureTrie // opened on first access
+	code    []byte           // code set since the last commit
+	dirty   bool             // modified since the last commit
+}
+
+// StateDB stores the accounts in a secure account trie, keyed by the hash of their address.
+// The storage of every account lives in its own secure storage trie, keyed by the hash
+// of the slot. All tries, as well as the contract code, share a single storage
+type StateDB struct {
+	db       storage.Storage
+	accounts *trie.SecureTrie
+	objects  map[common.Address]*stateObject
+	mu       sync.Mutex
+}
+
+// New opens the state with the given root. An empty root opens an empty state
+func New(root common.Hash, db storage.Storage) (*StateDB, error) {
+	accounts, err := openTrie(root, db)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StateDB{
+		db:       db,
+		accounts: accounts,
+		objects:  make(map[common.Address]*stateObject),
+	}, nil
+}
+
+// openTrie opens the secure trie with the given root
+func openTrie(root common.Hash, db storage.Storage) (*trie.SecureTrie, error) {
+	return trie.NewSecureTrieAt(trieRoot(root), db, false)
+}
+
+// Exist reports whether the account is in the state
+func (s *StateDB) Exist(addr common.Address) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	object, err := s.getObject(addr)
+
+	return object != nil, err
+}
+
+// GetNonce returns the nonce of the account, 0 if it does not exist
+func (s *StateDB) GetNonce(addr common.Address) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	object, err := s.getObject(addr)
+	if err != nil || object == nil {
+		return 0, err
+	}
+
+	return object.account.Nonce, nil
+}
+
+// SetNonce sets the nonce of the account, creating it if it does not exist
+func (s *StateDB) SetNonce(addr common.Address, nonce uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	object, err := s.getOrNewObject(addr)
+	if err != nil {
+		return err
+	}
+
+	object.account.Nonce = nonce
+	object.dirty = true
+
+	return nil
+}
+
+// GetBalance returns the balance of the account, 0 if it does not exist
+func (s *StateDB) GetBalance(addr common.Address) (*big.Int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	object, err := s.getObject(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if object == nil {
+		return new(big.Int), nil
+	}
+
+	return new(big.Int).Set(object.account.Balance), nil
+}
+
+// SetBalance sets the balance of the account, creating it if it does not exist
+func (s *StateDB) SetBalance(addr common.Address, balance *big.Int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	object, err := s.getOrNewObject(addr)
+	if err != nil {
+		return err
+	}
+
+	object.account.Balance = new(big.Int).Set(balance)
+	object.dirty = true
+
+	return nil
+}
+
+// GetCodeHash returns the code hash of the account, the zero hash if it does not exist
+func (s *StateDB) GetCodeHash(addr common.Address) (common.Hash, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	object, err := s.getObject(addr)
+	if err != nil || object == nil {
+		return common.Hash{}, err
+	}
+
+	return common.BytesToHash(object.account.CodeHash), nil
+}
+
+// GetCode returns the code of the account, nil if it has none
+func (s *StateDB) GetCode(addr common.Address) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	object, err := s.getObject(addr)
+	if err != nil || object == nil {
+		return nil, err
+	}
+
+	if object.code != nil {
+		return object.code, nil
+	}
+
+	if bytes.Equal(object.account.CodeHash, emptyCodeHash) {
+		return nil, nil
+	}
+
+	code, err := s.db.Get(codeKey(object.account.CodeHash))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load code %x: %w", object.account.CodeHash, err)
+	}
+
+	return code, nil
+}
+
+// SetCode sets the code of the account, creating it if it does not exist
+func (s *StateDB) SetCode(addr common.Address, code []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	object, err := s.getOrNewObject(addr)
+	if err != nil {
+		return err
+	}
+
+	object.code = append([]byte{}, code...)
+	object.account.CodeHash = crypto.Keccak256(code)
+	object.dirty = true
+
+	return nil
+}
+
+// GetState returns the value of a storage slot of the account, the zero hash if it is not set
+func (s *StateDB) GetState(addr common.Address, slot common.Hash) (common.Hash, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	object, err := s.getObject(addr)
+	if err != nil || object == nil {
+		return common.Hash{}, err
+	}
+
+	return s.getState(object, slot)
+}
+
+// getState returns the value of a storage slot of the account, the zero hash if it is not set
+func (s *StateDB) getState(object *stateObject, slot common.Hash) (common.Hash, error) {
+	storageTrie, err := s.storageTrie(object)
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	data, err := storageTrie.Get(slot.Bytes())
+	if errors.Is(err, trie.ErrKeyNotFound) {
+		return common.Hash{}, nil
+	}
+
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	// values are stored RLP-encoded without leading zeroes
+	_, content, _, err := rlp.Split(data)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("failed to decode storage slot %x: %w", slot, err)
+	}
+
+	return common.BytesToHash(content), nil
+}
+
+// SetState sets the value of a storage slot of the account, creating it if it does not exist.
+// Setting the zero hash removes the slot
+func (s *StateDB) SetState(addr common.Address, slot, value common.Hash) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	object, err := s.getOrNewObject(addr)
+	if err != nil {
+		return err
+	}
+
+	storageTrie, err := s.storageTrie(object)
+	if err != nil {
+		return err
+	}
+
+	object.dirty = true
+
+	if value == (common.Hash{}) {
+		if err := storageTrie.Del(slot.Bytes()); err != nil && !errors.Is(err, trie.ErrKeyNotFound) {
+			return err
+		}
+
+		return nil
+	}
+
+	data, err := rlp.EncodeToBytes(common.TrimLeftZeroes(value.Bytes()))
+	if err != nil {
+		return fmt.Errorf("failed to encode storage slot %x: %w", slot, err)
+	}
+
+	return storageTrie.Put(slot.Bytes(), data)
+}
+
+// Commit persists the modified accounts and returns the state root. The storage tries
+// and the code are written first, so the account leaves hold the roots of the storage tries
+func (s *StateDB) Commit() (common.Hash, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	addresses := make([]common.Address, 0, len(s.objects))
+
+	for addr, object := range s.objects {
+		if object.dirty {
+			addresses = append(addresses, addr)
+		}
+	}
+
+	sort.Slice(addresses, func(i, j int) bool {
+		return bytes.Compare(addresses[i].Bytes(), addresses[j].Bytes()) < 0
+	})
+
+	for _, addr := range addresses {
+		if err := s.commitObject(addr, s.objects[addr]); err != nil {
+			return common.Hash{}, err
+		}
+	}
+
+	root, err := s.accounts.Commit()
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("failed to commit the account trie: %w", err)
+	}
+
+	return common.BytesToHash(root), nil
+}
+
+// commitObject persists the code and the storage trie of the account, then its account leaf
+func (s *StateDB) commitObject(addr common.Address, object *stateObject) error {
+	if object.code != nil {
+		if err := s.db.Put(codeKey(object.account.CodeHash), object.code); err != nil {
+			return fmt.Errorf("failed to store code of %s: %w", addr, err)
+		}
+
+		object.code = nil
+	}
+
+	if object.storage != nil {
+		root, err := object.storage.Commit()
+		if err != nil {
+			return fmt.Errorf("failed to commit the storage trie of %s: %w", addr, err)
+		}
+
+		object.account.Root = common.BytesToHash(root)
+	}
+
+	data, err := rlp.EncodeToBytes(object.account)
+	if err != nil {
+		return fmt.Errorf("failed to encode account %s: %w", addr, err)
+	}
+
+	if err := s.accounts.Put(addr.Bytes(), data); err != nil {
+		return err
+	}
+
+	object.dirty = false
+
+	return nil
+}
+
+// getObject returns the account, loading it from the account trie. It returns nil if the account does not exist
+func (s *StateDB) getObject(addr common.Address) (*stateObject, error) {
+	if object, ok := s.objects[addr]; ok {
+		return object, nil
+	}
+
+	data, err := s.accounts.Get(addr.Bytes())
+	if errors.Is(err, trie.ErrKeyNotFound) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to load account %s: %w", addr, err)
+	}
+
+	account, err := decodeAccount(data)
+	if err != nil {
+		return nil, err
+	}
+
+	object := &stateObject{account: account}
+	s.objects[addr] = object
+
+	return object, nil
+}
+
+// getOrNewObject returns the account, creating it if it does not exist
+func (s *StateDB) getOrNewObject(addr common.Address) (*stateObject, error) {
+	object, err := s.getObject(addr)
+	if err != nil || object != nil {
+		return object, err
+	}
+
+	object = &stateObject{account: newAccount(), dirty: true}
+	s.objects[addr] = object
+
+	return object, nil
+}
+
+// storageTrie returns the storage trie of the account, opening it at its root on first access
+func (s *StateDB) storageTrie(object *stateObject) (*trie.SecureTrie, error) {
+	if object.storage != nil {
+		return object.storage, nil
+	}
+
+	storageTrie, err := openTrie(object.account.Root, s.db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open storage trie %x: %w", object.account.Root, err)
+	}
+
+	object.storage = storageTrie
+
+	return storageTrie, nil
+}
+
+// codeKey returns the storage key of the code with the given hash
+func codeKey(codeHash []byte) []byte {
+	return append([]byte(codePrefix), codeHash...)
+}
@@ -0,0 +1,260 @@
+package state
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/Aleksao998/Merkle-Patricia-Trie/storage/mpt"
+	"github.com/Aleksao998/Merkle-Patricia-Trie/trie"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	ethereumState "github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testAccount is the expected content of an account in the tests
+type testAccount struct {
+	nonce   uint64
+	balance *big.Int
+	code    []byte
+	storage map[common.Hash]common.Hash
+}
+
+// stateTestAccounts returns accounts with and without code and storage
+func stateTestAccounts() map[common.Address]*testAccount {
+	accounts := make(map[common.Address]*testAccount)
+
+	for i := 0; i < 50; i++ {
+		account := &testAccount{
+			nonce:   uint64(i),
+			balance: big.NewInt(int64(i+1) * 1000),
+			storage: make(map[common.Hash]common.Hash),
+		}
+
+		if i%3 == 0 {
+			account.code = []byte(fmt.Sprintf("code-%d", i))
+		}
+
+		for j := 0; j < i%7; j++ {
+			account.storage[common.BigToHash(big.NewInt(int64(j)))] = common.BigToHash(big.NewInt(int64(i*100 + j + 1)))
+		}
+
+		accounts[common.BigToAddress(big.NewInt(int64(i+1)))] = account
+	}
+
+	return accounts
+}
+
+// TestStateMatchesEthereum tests that the state root is the same as the one of go-ethereum
+func TestStateMatchesEthereum(t *testing.T) {
+	t.Parallel()
+
+	stateDB, err := New(common.Hash{}, mpt.NewMPTMemoryStorage())
+	require.NoError(t, err)
+
+	ethereumStateDB, err := ethereumState.New(
+		types.EmptyRootHash,
+		ethereumState.NewDatabase(rawdb.NewMemoryDatabase()),
+		nil,
+	)
+	require.NoError(t, err)
+
+	root, err := stateDB.Commit()
+	require.NoError(t, err)
+	assert.Equal(t, types.EmptyRootHash, root)
+
+	for addr, account := range stateTestAccounts() {
+		require.NoError(t, stateDB.SetNonce(addr, account.nonce))
+		require.NoError(t, stateDB.SetBalance(addr, account.balance))
+		ethereumStateDB.SetNonce(addr, account.nonce)
+		ethereumStateDB.SetBalance(addr, account.balance)
+
+		if account.code != nil {
+			require.NoError(t, stateDB.SetCode(addr, account.code))
+			ethereumStateDB.SetCode(addr, account.code)
+		}
+
+		for slot, value := range account.storage {
+			require.NoError(t, stateDB.SetState(addr, slot, value))
+			ethereumStateDB.SetState(addr, slot, value)
+		}
+	}
+
+	root, err = stateDB.Commit()
+	require.NoError(t, err)
+	assert.Equal(t, ethereumStateDB.IntermediateRoot(false), root)
+
+	// clearing a slot removes it from the storage trie
+	addr := common.BigToAddress(big.NewInt(6))
+	slot := common.BigToHash(big.NewInt(2))
+
+	require.NoError(t, stateDB.SetState(addr, slot, common.Hash{}))
+	ethereumStateDB.SetState(addr, slot, common.Hash{})
+
+	root, err = stateDB.Commit()
+	require.NoError(t, err)
+	assert.Equal(t, ethereumStateDB.IntermediateRoot(false), root)
+}
+
+// TestStateReload tests that the committed accounts are read back through the typed getters
+func TestStateReload(t *testing.T) {
+	t.Parallel()
+
+	db := mpt.NewMPTMemoryStorage()
+	accounts := stateTestAccounts()
+
+	stateDB, err := New(common.Hash{}, db)
+	require.NoError(t, err)
+
+	for addr, account := range accounts {
+		require.NoError(t, stateDB.SetNonce(addr, account.nonce))
+		require.NoError(t, stateDB.SetBalance(addr, account.balance))
+
+		if account.code != nil {
+			require.NoError(t, stateDB.SetCode(addr, account.code))
+		}
+
+		for slot, value := range account.storage {
+			require.NoError(t, stateDB.SetState(addr, slot, value))
+		}
+	}
+
+	root, err := stateDB.Commit()
+	require.NoError(t, err)
+
+	reloaded, err := New(root, db)
+	require.NoError(t, err)
+
+	for addr, account := range accounts {
+		exists, err := reloaded.Exist(addr)
+		require.NoError(t, err)
+		assert.True(t, exists)
+
+		nonce, err := reloaded.GetNonce(addr)
+		require.NoError(t, err)
+		assert.Equal(t, account.nonce, nonce)
+
+		balance, err := reloaded.GetBalance(addr)
+		require.NoError(t, err)
+		assert.Equal(t, 0, account.balance.Cmp(balance))
+
+		code, err := reloaded.GetCode(addr)
+		require.NoError(t, err)
+		assert.Equal(t, account.code, code)
+
+		for slot, value := range account.storage {
+			stored, err := reloaded.GetState(addr, slot)
+			require.NoError(t, err)
+			assert.Equal(t, value, stored)
+		}
+	}
+
+	// missing accounts and slots read as zero values
+	missing := common.HexToAddress("0xdead")
+
+	exists, err := reloaded.Exist(missing)
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	balance, err := reloaded.GetBalance(missing)
+	require.NoError(t, err)
+	assert.Equal(t, 0, balance.Sign())
+
+	value, err := reloaded.GetState(common.BigToAddress(big.NewInt(1)), common.HexToHash("0xff"))
+	require.NoError(t, err)
+	assert.Equal(t, common.Hash{}, value)
+
+	// committing without changes keeps the root
+	unchanged, err := reloaded.Commit()
+	require.NoError(t, err)
+	assert.Equal(t, root, unchanged)
+}
+
+// TestPruneState tests that pruning and reference counting keep the storage tries
+// of the accounts of the kept states
+func TestPruneState(t *testing.T) {
+	t.Parallel()
+
+	memory := mpt.NewMPTMemoryStorage()
+	db := trie.NewRefCountedStorage(memory, StorageRoots)
+	accounts := stateTestAccounts()
+
+	stateDB, err := New(common.Hash{}, db)
+	require.NoError(t, err)
+
+	var (
+		roots        []common.Hash
+		storageRoots []common.Hash // storage roots of an account with storage
+	)
+
+	withStorage := common.BigToAddress(big.NewInt(2))
+
+	for version := 0; version < 3; version++ {
+		for addr, account := range accounts {
+			require.NoError(t, stateDB.SetNonce(addr, account.nonce+uint64(version)))
+
+			// the storage tries change with every version
+			for slot, value := range account.storage {
+				value[0] = byte(version + 1)
+				account.storage[slot] = value
+
+				require.NoError(t, stateDB.SetState(addr, slot, value))
+			}
+		}
+
+		root, err := stateDB.Commit()
+		require.NoError(t, err)
+
+		db.Reference(root.Bytes())
+		roots = append(roots, root)
+		storageRoots = append(storageRoots, stateDB.objects[withStorage].account.Root)
+	}
+
+	// checkState checks that the last state is fully readable
+	checkState := func() {
+		reloaded, err := New(roots[2], memory)
+		require.NoError(t, err)
+
+		for addr, account := range accounts {
+			nonce, err := reloaded.GetNonce(addr)
+			require.NoError(t, err)
+			assert.Equal(t, account.nonce+2, nonce)
+
+			for slot, value := range account.storage {
+				stored, err := reloaded.GetState(addr, slot)
+				require.NoError(t, err)
+				assert.Equal(t, value, stored)
+			}
+		}
+	}
+
+	deleted, err := db.Dereference(roots[0].Bytes())
+	require.NoError(t, err)
+	assert.Positive(t, deleted)
+
+	// the storage trie of the released state is released with it
+	found, err := memory.Has(storageRoots[0].Bytes())
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	checkState()
+
+	progress, err := trie.Prune(memory, [][]byte{roots[2].Bytes()}, StorageRoots, nil)
+	require.NoError(t, err)
+	assert.Positive(t, progress.Deleted)
+
+	checkState()
+
+	// without following the account leaves the storage tries are swept
+	_, err = trie.Prune(memory, [][]byte{roots[2].Bytes()}, nil, nil)
+	require.NoError(t, err)
+
+	reloaded, err := New(roots[2], memory)
+	require.NoError(t, err)
+
+	_, err = reloaded.GetState(withStorage, common.BigToHash(big.NewInt(0)))
+	assert.Error(t, err)
+}
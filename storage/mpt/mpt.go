@@ -2,6 +2,7 @@ package mpt
 
 import (
 	"errors"
+	"sort"
 	"sync"
 )
 
@@ -54,3 +55,33 @@ func (m *MPTMemoryStorage) Delete(key []byte) error {
 
 	return nil
 }
+
+// Iterate calls fn for every key-value pair with a key greater than or equal to start,
+// in key order, until fn returns false. The keys are collected first, so fn may modify the storage
+func (m *MPTMemoryStorage) Iterate(start []byte, fn func(key, value []byte) bool) error {
+	m.mu.RLock()
+
+	keys := make([]string, 0, len(m.data))
+
+	for key := range m.data {
+		if key >= string(start) {
+			keys = append(keys, key)
+		}
+	}
+
+	m.mu.RUnlock()
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		m.mu.RLock()
+		value, ok := m.data[key]
+		m.mu.RUnlock()
+
+		if ok && !fn([]byte(key), value) {
+			break
+		}
+	}
+
+	return nil
+}
@@ -68,3 +68,29 @@ func TestMPTMemoryStorage_Delete_ExistentKey(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "key not found")
 }
+
+func TestMPTMemoryStorage_Iterate(t *testing.T) {
+	storage := NewMPTMemoryStorage()
+
+	for _, key := range []string{"c", "a", "d", "b"} {
+		assert.NoError(t, storage.Put([]byte(key), []byte("value-"+key)))
+	}
+
+	var keys []string
+
+	err := storage.Iterate([]byte("b"), func(key, value []byte) bool {
+		keys = append(keys, string(key))
+		assert.Equal(t, "value-"+string(key), string(value))
+
+		// deleting while iterating is allowed
+		assert.NoError(t, storage.Delete(key))
+
+		return string(key) != "c"
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b", "c"}, keys)
+
+	has, err := storage.Has([]byte("d"))
+	assert.NoError(t, err)
+	assert.True(t, has)
+}
@@ -47,7 +47,8 @@ func (p *Storage) Get(key []byte) ([]byte, error) {
 	}
 	defer closer.Close()
 
-	return value, nil
+	// the value is only valid until the closer is closed
+	return append([]byte{}, value...), nil
 }
 
 // Put inserts the given value into the key-value data store.
@@ -55,11 +56,57 @@ func (p *Storage) Put(key []byte, value []byte) error {
 	return p.db.Set(key, value, pebble.Sync)
 }
 
+// PutBatch inserts all the given key-value pairs into the key-value data store in a single write
+func (p *Storage) PutBatch(keys, values [][]byte) error {
+	return p.WriteBatch(nil, keys, values)
+}
+
+// WriteBatch removes the given keys and inserts the given key-value pairs in a single write
+func (p *Storage) WriteBatch(deletes, keys, values [][]byte) error {
+	batch := p.db.NewBatch()
+	defer batch.Close()
+
+	for _, key := range deletes {
+		if err := batch.Delete(key, nil); err != nil {
+			return err
+		}
+	}
+
+	for i := range keys {
+		if err := batch.Set(keys[i], values[i], nil); err != nil {
+			return err
+		}
+	}
+
+	return batch.Commit(pebble.Sync)
+}
+
 // Delete removes the key from the key-value data store.
 func (p *Storage) Delete(key []byte) error {
 	return p.db.Delete(key, pebble.Sync)
 }
 
+// Iterate calls fn for every key-value pair with a key greater than or equal to start, in key order,
+// until fn returns false. The iterator reads a snapshot, so fn may modify the data store
+func (p *Storage) Iterate(start []byte, fn func(key, value []byte) bool) error {
+	iter := p.db.NewIter(&pebble.IterOptions{LowerBound: start})
+
+	for valid := iter.First(); valid; valid = iter.Next() {
+		value, err := iter.ValueAndErr()
+		if err != nil {
+			iter.Close()
+
+			return err
+		}
+
+		if !fn(append([]byte{}, iter.Key()...), append([]byte{}, value...)) {
+			break
+		}
+	}
+
+	return iter.Close()
+}
+
 // Close closes the database connection and returns an error if any issue occurs during the operation
 func (p *Storage) Close() error {
 	return p.db.Close()
@@ -146,3 +146,100 @@ func TestPebbleStorage_Delete(t *testing.T) {
 	_, err = store.Get(key)
 	assert.ErrorIs(t, err, pebble.ErrNotFound)
 }
+
+func TestPebbleStorage_Iterate(t *testing.T) {
+	t.Parallel()
+
+	// Initialize PebbleStorage
+	tempDir, store, err := createPebbleStorage()
+	if err != nil {
+		t.Fatalf("error creating pebble storage, %v", err)
+	}
+
+	defer os.RemoveAll(tempDir)
+	defer store.Close()
+
+	for i := 0; i < 10; i++ {
+		if err := store.Put([]byte(fmt.Sprintf("key_%d", i)), []byte(fmt.Sprintf("value_%d", i))); err != nil {
+			t.Fatalf("Error setting value: %v", err)
+		}
+	}
+
+	var keys []string
+
+	err = store.Iterate([]byte("key_5"), func(key, value []byte) bool {
+		keys = append(keys, string(key))
+		assert.Equal(t, "value_"+string(key[4:]), string(value))
+
+		// deleting while iterating is allowed
+		assert.NoError(t, store.Delete(key))
+
+		return true
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"key_5", "key_6", "key_7", "key_8", "key_9"}, keys)
+
+	has, err := store.Has([]byte("key_4"))
+	assert.NoError(t, err)
+	assert.True(t, has)
+
+	has, err = store.Has([]byte("key_5"))
+	assert.NoError(t, err)
+	assert.False(t, has)
+}
+
+// Test for PutBatch method
+func TestPebbleStorage_PutBatch(t *testing.T) {
+	t.Parallel()
+
+	// Initialize PebbleStorage
+	tempDir, store, err := createPebbleStorage()
+	if err != nil {
+		t.Fatalf("error creating pebble storage, %v", err)
+	}
+
+	defer os.RemoveAll(tempDir)
+	defer store.Close()
+
+	var keys, values [][]byte
+
+	for i := 0; i < 10; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("key_%d", i)))
+		values = append(values, []byte(fmt.Sprintf("value_%d", i)))
+	}
+
+	assert.NoError(t, store.PutBatch(keys, values))
+
+	for i := range keys {
+		value, err := store.Get(keys[i])
+		assert.NoError(t, err)
+		assert.Equal(t, values[i], value)
+	}
+}
+
+// Test for WriteBatch method
+func TestPebbleStorage_WriteBatch(t *testing.T) {
+	t.Parallel()
+
+	// Initialize PebbleStorage
+	tempDir, store, err := createPebbleStorage()
+	if err != nil {
+		t.Fatalf("error creating pebble storage, %v", err)
+	}
+
+	defer os.RemoveAll(tempDir)
+	defer store.Close()
+
+	assert.NoError(t, store.Put([]byte("old_key"), []byte("old_value")))
+
+	err = store.WriteBatch([][]byte{[]byte("old_key")}, [][]byte{[]byte("new_key")}, [][]byte{[]byte("new_value")})
+	assert.NoError(t, err)
+
+	has, err := store.Has([]byte("old_key"))
+	assert.NoError(t, err)
+	assert.False(t, has)
+
+	value, err := store.Get([]byte("new_key"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("new_value"), value)
+}
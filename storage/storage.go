@@ -13,3 +13,19 @@ type Storage interface {
 	// Delete removes the key from the key-value data store.
 	Delete(key []byte) error
 }
+
+// Iterable is implemented by the storages able to walk their keys in order
+type Iterable interface {
+	// Iterate calls fn for every key-value pair with a key greater than or equal to start,
+	// in key order, until fn returns false. The pairs may be modified by fn
+	Iterate(start []byte, fn func(key, value []byte) bool) error
+}
+
+// Batcher is implemented by the storages able to write several pairs at once
+type Batcher interface {
+	// PutBatch inserts all the given key-value pairs into the key-value data store in a single write
+	PutBatch(keys, values [][]byte) error
+
+	// WriteBatch removes the given keys and inserts the given key-value pairs in a single write
+	WriteBatch(deletes, keys, values [][]byte) error
+}
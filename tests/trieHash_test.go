@@ -10,6 +10,7 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type ActionType string
@@ -77,6 +78,9 @@ func TestFromJSON(t *testing.T) {
 
 		exp := common.HexToHash(example.Root)
 
-		assert.Equal(t, exp.Bytes(), tr.Hash(), "Test #%d: Unexpected root hash", idx+1)
+		root, err := tr.Hash()
+		require.NoError(t, err, "Test #%d: Failed to hash trie", idx+1)
+
+		assert.Equal(t, exp.Bytes(), root, "Test #%d: Unexpected root hash", idx+1)
 	}
 }
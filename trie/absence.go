@@ -0,0 +1,98 @@
+package trie
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Aleksao998/Merkle-Patricia-Trie/storage"
+	"github.com/Aleksao998/Merkle-Patricia-Trie/storage/mpt"
+)
+
+// ErrKeyExists is returned when a proof of absence is requested for a key that is in the trie
+var ErrKeyExists = errors.New("key exists in the trie")
+
+// AbsenceKind describes where the path of a missing key diverges from the trie
+type AbsenceKind int
+
+const (
+	// AbsenceNone means the key is in the trie
+	AbsenceNone AbsenceKind = iota
+	// AbsenceEmptyTrie means the trie holds no keys at all
+	AbsenceEmptyTrie
+	// AbsenceEmptySlot means the path reaches an empty child slot of a branch node
+	AbsenceEmptySlot
+	// AbsenceLeafMismatch means the path reaches a leaf node holding a different key
+	AbsenceLeafMismatch
+	// AbsenceExtensionMismatch means the path diverges from the path of an extension node
+	AbsenceExtensionMismatch
+	// AbsenceMissingValue means the path ends at a branch node that holds no value
+	AbsenceMissingValue
+)
+
+// String returns a human readable name of the divergence
+func (k AbsenceKind) String() string {
+	switch k {
+	case AbsenceNone:
+		return "none"
+	case AbsenceEmptyTrie:
+		return "empty trie"
+	case AbsenceEmptySlot:
+		return "empty branch slot"
+	case AbsenceLeafMismatch:
+		return "mismatching leaf path"
+	case AbsenceExtensionMismatch:
+		return "diverging extension"
+	case AbsenceMissingValue:
+		return "branch without value"
+	default:
+		return fmt.Sprintf("AbsenceKind(%d)", int(k))
+	}
+}
+
+// AbsenceProof proves that a key is not in the trie
+type AbsenceProof struct {
+	// Kind is the point where the path of the key diverges from the trie
+	Kind AbsenceKind
+	// Proof holds the nodes from the root down to the divergence point
+	Proof storage.Storage
+}
+
+// ProveAbsence returns a proof of exclusion for the key.
+// ErrKeyExists is returned if the key is in the trie
+func (t *Trie) ProveAbsence(key []byte) (*AbsenceProof, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.getRootHash(); err != nil {
+		return nil, err
+	}
+
+	db := mpt.NewMPTMemoryStorage()
+
+	kind, err := t.proveInto(db, t.root, key)
+	if err == nil {
+		return nil, ErrKeyExists
+	}
+
+	if !errors.Is(err, ErrKeyNotFound) {
+		return nil, err
+	}
+
+	return &AbsenceProof{Kind: kind, Proof: db}, nil
+}
+
+// VerifyAbsence checks a proof of exclusion of the key against the root hash.
+// It returns true for a valid proof of absence and false for a valid proof of inclusion.
+// ErrInvalidProof is returned if the proof cannot be trusted
+func VerifyAbsence(rootHash []byte, key []byte, proof storage.Storage) (bool, error) {
+	_, err := VerifyProof(rootHash, key, proof)
+
+	switch {
+	case errors.Is(err, ErrKeyAbsent):
+		return true, nil
+	case err != nil:
+		return false, err
+	default:
+		return false, nil
+	}
+}
@@ -0,0 +1,82 @@
+package trie
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Aleksao998/Merkle-Patricia-Trie/storage/mpt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestProveAbsence tests that every kind of divergence produces a verifiable proof of exclusion
+func TestProveAbsence(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name    string
+		keys    []string
+		missing string
+		kind    AbsenceKind
+	}{
+		{"empty trie", nil, "dog", AbsenceEmptyTrie},
+		{"mismatching leaf path", []string{"exists"}, "nonexistent", AbsenceLeafMismatch},
+		{"empty branch slot", []string{"do", "dog", "horse"}, "cat", AbsenceEmptySlot},
+		{"diverging extension", []string{"dog1", "dog2"}, "dox", AbsenceExtensionMismatch},
+		{"branch without value", []string{"dog\x10", "dog\x20"}, "dog", AbsenceMissingValue},
+	}
+
+	for _, tt := range testCases {
+		trie := NewTrie(mpt.NewMPTMemoryStorage())
+
+		for _, key := range tt.keys {
+			require.NoError(t, trie.Put([]byte(key), bytes.Repeat([]byte(key), 10)))
+		}
+
+		root, err := trie.Hash()
+		require.NoError(t, err)
+
+		absence, err := trie.ProveAbsence([]byte(tt.missing))
+		require.NoError(t, err, tt.name)
+		assert.Equal(t, tt.kind, absence.Kind, tt.name)
+
+		absent, err := VerifyAbsence(root, []byte(tt.missing), absence.Proof)
+		require.NoError(t, err, tt.name)
+		assert.True(t, absent, tt.name)
+	}
+}
+
+// TestProveAbsenceOfExistingKey tests that an existing key cannot be proven absent
+// and that an inclusion proof is not accepted as an exclusion proof
+func TestProveAbsenceOfExistingKey(t *testing.T) {
+	t.Parallel()
+
+	trie, _ := newProofTestTrie(t)
+
+	_, err := trie.ProveAbsence([]byte("dog"))
+	require.ErrorIs(t, err, ErrKeyExists)
+
+	root, err := trie.Hash()
+	require.NoError(t, err)
+
+	proof, err := trie.Proof([]byte("dog"))
+	require.NoError(t, err)
+
+	absent, err := VerifyAbsence(root, []byte("dog"), proof)
+	require.NoError(t, err)
+	assert.False(t, absent)
+}
+
+// TestVerifyAbsenceInvalid tests that an exclusion proof for another root is rejected
+func TestVerifyAbsenceInvalid(t *testing.T) {
+	t.Parallel()
+
+	trie, _ := newProofTestTrie(t)
+
+	absence, err := trie.ProveAbsence([]byte("cat"))
+	require.NoError(t, err)
+
+	absent, err := VerifyAbsence(bytes.Repeat([]byte{1}, 32), []byte("cat"), absence.Proof)
+	require.ErrorIs(t, err, ErrInvalidProof)
+	assert.False(t, absent)
+}
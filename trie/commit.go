@@ -3,6 +3,7 @@ package trie
 import (
 	"fmt"
 
+	"github.com/Aleksao998/Merkle-Patricia-Trie/trie/crypto"
 	"github.com/Aleksao998/Merkle-Patricia-Trie/trie/nibble"
 	nodes2 "github.com/Aleksao998/Merkle-Patricia-Trie/trie/nodes"
 	"github.com/ethereum/go-ethereum/rlp"
@@ -10,110 +11,289 @@ import (
 
 const rootHashKey = "rootHash"
 
+// rootPointerKey returns the storage key of the root pointer of a trie.
+// The root of a trie without ID is stored under rootHashKey
+func rootPointerKey(id string) []byte {
+	if id == "" {
+		return []byte(rootHashKey)
+	}
+
+	return []byte(rootHashKey + "/" + id)
+}
+
+// commit stores the root node and its subtree in storage and returns the root hash.
+// The root node itself is always stored, even if its encoding is shorter than 32 bytes.
+// Only dirty nodes are written, clean subtrees collapse to the hash they are stored under
 func (t *Trie) commit(node nodes2.Node) ([]byte, error) {
+	switch n := node.(type) {
+	case *nodes2.HashNode:
+		return n.Hash, nil
+	case nil:
+		if t.paths != nil {
+			// the whole trie was deleted
+			return nil, t.paths.replace(nil, nil)
+		}
+
+		return nil, nil // Empty Trie
+	default:
+		if hash := storedHash(n); hash != nil {
+			return hash, nil
+		}
+
+		encoded, err := t.commitNode(n, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		hash, err := t.storeEncoded(nil, n, encoded)
+		if err != nil {
+			return nil, err
+		}
+
+		t.setCommitted(n, hash)
+
+		return hash, nil
+	}
+}
+
+// commitChild commits a child node at the given path and returns the reference its parent should hold.
+// Following the Ethereum rules, children whose encoding is shorter than 32 bytes are
+// embedded in their parent and never stored separately, others are replaced by their hash
+func (t *Trie) commitChild(node nodes2.Node, path []nibble.Nibble) (nodes2.Node, error) {
+	switch n := node.(type) {
+	case *nodes2.HashNode, nil:
+		return n, nil
+	default:
+		if hash := storedHash(n); hash != nil {
+			return &nodes2.HashNode{Hash: hash, Path: path}, nil
+		}
+
+		encoded, err := t.commitNode(n, path)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(encoded) < 32 {
+			t.setCommitted(n, nil)
+
+			return n, nil
+		}
+
+		hash, err := t.storeEncoded(path, n, encoded)
+		if err != nil {
+			return nil, err
+		}
+
+		t.setCommitted(n, hash)
+
+		return &nodes2.HashNode{Hash: hash, Path: path}, nil
+	}
+}
+
+// commitNode commits the children of the node at the given path and returns the node encoding
+func (t *Trie) commitNode(node nodes2.Node, path []nibble.Nibble) ([]byte, error) {
 	switch n := node.(type) {
 	case *nodes2.LeafNode:
 		return t.handleLeafNode(n)
 	case *nodes2.ExtensionNode:
-		return t.handleExtensionNode(n)
+		return t.handleExtensionNode(n, path)
 	case *nodes2.BranchNode:
-		return t.handleBranchNode(n)
-	case *nodes2.HashNode:
-		return n.Hash, nil
+		return t.handleBranchNode(n, path)
 	default:
-		panic("Unknown node type")
+		return nil, fmt.Errorf("%w: %T", errUnexpectedNode, node)
 	}
 }
 
 func (t *Trie) handleLeafNode(n *nodes2.LeafNode) ([]byte, error) {
-	raw := t.NodeRaw(n, false)
+	return t.encodeNode(n)
+}
 
-	encoded, err := rlp.EncodeToBytes(raw)
+func (t *Trie) handleExtensionNode(n *nodes2.ExtensionNode, path []nibble.Nibble) ([]byte, error) {
+	child, err := t.commitChild(n.Node, appendPath(path, n.Path))
 	if err != nil {
 		return nil, err
 	}
 
-	hash := t.NodeHash(n)
+	// replace the child with its committed reference
+	t.setChild(&n.Node, child)
 
-	err = t.storage.Put(hash, encoded)
-	if err != nil {
-		return nil, err
+	return t.encodeNode(n)
+}
+
+func (t *Trie) handleBranchNode(n *nodes2.BranchNode, path []nibble.Nibble) ([]byte, error) {
+	for index, child := range n.Children {
+		if child != nil {
+			committedChild, err := t.commitChild(child, appendPath(path, []nibble.Nibble{nibble.Nibble(index)}))
+			if err != nil {
+				return nil, err
+			}
+
+			t.setChild(&n.Children[index], committedChild)
+		}
 	}
 
-	return hash, nil
+	return t.encodeNode(n)
 }
 
-func (t *Trie) handleExtensionNode(n *nodes2.ExtensionNode) ([]byte, error) {
-	childHash, err := t.commit(n.Node)
-	if err != nil {
-		return nil, err
+// setChild replaces a child by its committed reference. A parallel commit records the former
+// child, to restore it if the batch cannot be written
+func (t *Trie) setChild(child *nodes2.Node, committed nodes2.Node) {
+	if t.batch != nil {
+		former := *child
+		t.batch.record(func() {
+			*child = former
+		})
 	}
 
-	// replace the node with its hash node
-	n.Node = nodes2.NewHashNode(childHash)
+	*child = committed
+}
 
-	raw := t.NodeRaw(n, false)
+// setCommitted marks a committed node clean under the given hash. A parallel commit records
+// the former state of the node, to restore it if the batch cannot be written
+func (t *Trie) setCommitted(node nodes2.Node, hash []byte) {
+	if t.batch != nil {
+		dirty, cache := isDirty(node), *nodes2.CacheOf(node)
+		t.batch.record(func() {
+			restoreNode(node, dirty, cache)
+		})
+	}
 
-	encoded, err := rlp.EncodeToBytes(raw)
-	if err != nil {
-		return nil, err
+	markClean(node, hash)
+}
+
+// storeEncoded writes the encoding of a node at the given path and returns the node hash.
+// With the hash scheme the node is stored under its hash, with the path scheme
+// it replaces the node stored at its path when the commit is flushed
+func (t *Trie) storeEncoded(path []nibble.Nibble, node nodes2.Node, encoded []byte) ([]byte, error) {
+	hash := crypto.Keccak256(encoded)
+
+	if t.paths != nil {
+		if err := t.paths.replace(path, node); err != nil {
+			return nil, err
+		}
+
+		t.paths.stage(path, encoded)
+
+		return hash, nil
 	}
 
-	hash := t.NodeHash(n)
+	if t.batch != nil {
+		t.batch.put(hash, encoded)
 
-	err = t.storage.Put(hash, encoded)
+		return hash, nil
+	}
 
-	if err != nil {
-		return nil, err
+	if err := t.storage.Put(hash, encoded); err != nil {
+		return nil, fmt.Errorf("failed to store node %x: %w", hash, err)
 	}
 
 	return hash, nil
 }
 
-func (t *Trie) handleBranchNode(n *nodes2.BranchNode) ([]byte, error) {
-	for index, child := range n.Children {
-		if child != nil {
-			childHash, err := t.commit(child)
-			if err != nil {
-				return nil, err
-			}
+// DecodeNode loads the root node stored under the given hash and decodes it
+func (t *Trie) DecodeNode(hash []byte) (nodes2.Node, error) {
+	return t.loadNode(hash, nil)
+}
 
-			n.Children[index] = nodes2.NewHashNode(childHash)
-		}
+// resolve loads the node referenced by a hash node
+func (t *Trie) resolve(n *nodes2.HashNode) (nodes2.Node, error) {
+	return t.loadNode(n.Hash, n.Path)
+}
+
+// loadNode loads and decodes the node with the given hash located at the given path.
+// The hash scheme looks the node up by its hash, the path scheme by its path
+func (t *Trie) loadNode(hash []byte, path []nibble.Nibble) (nodes2.Node, error) {
+	var (
+		data []byte
+		err  error
+	)
+
+	if t.paths != nil {
+		data, err = t.paths.readNode(path, hash)
+	} else {
+		data, err = t.storage.Get(hash)
 	}
 
-	raw := t.NodeRaw(n, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load node %x: %w", hash, err)
+	}
 
-	encoded, err := rlp.EncodeToBytes(raw)
+	node, err := decodeNodeData(data, path)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to decode node %x: %w", hash, err)
 	}
 
-	hash := t.NodeHash(n)
+	markClean(node, hash)
 
-	err = t.storage.Put(hash, encoded)
-	if err != nil {
-		return nil, err
+	if cache := nodes2.CacheOf(node); cache != nil {
+		cache.Encoded = data
 	}
 
-	return hash, nil
+	return node, nil
 }
 
-func (t *Trie) DecodeNode(hash []byte) (nodes2.Node, error) {
-	data, err := t.storage.Get(hash)
-	if err != nil {
-		return nil, err
+// isDirty reports whether the node was modified since it was loaded or committed
+func isDirty(node nodes2.Node) bool {
+	switch n := node.(type) {
+	case *nodes2.LeafNode:
+		return n.Dirty
+	case *nodes2.ExtensionNode:
+		return n.Dirty
+	case *nodes2.BranchNode:
+		return n.Dirty
+	default:
+		return false
+	}
+}
+
+// storedHash returns the hash a clean node is stored under, or nil if the node is
+// dirty or embedded in its parent. Embedded nodes are small and simply re-encoded
+func storedHash(node nodes2.Node) []byte {
+	cache := nodes2.CacheOf(node)
+	if cache == nil || isDirty(node) {
+		return nil
+	}
+
+	return cache.Hash
+}
+
+// markClean clears the dirty flag of a node once it is persisted under the given hash,
+// which is nil for nodes embedded in their parent
+func markClean(node nodes2.Node, hash []byte) {
+	switch n := node.(type) {
+	case *nodes2.LeafNode:
+		n.Dirty, n.Cache.Hash = false, hash
+	case *nodes2.ExtensionNode:
+		n.Dirty, n.Cache.Hash = false, hash
+	case *nodes2.BranchNode:
+		n.Dirty, n.Cache.Hash = false, hash
 	}
+}
 
+// restoreNode sets back the dirty flag and the cache of a node
+func restoreNode(node nodes2.Node, dirty bool, cache nodes2.Cache) {
+	switch n := node.(type) {
+	case *nodes2.LeafNode:
+		n.Dirty, n.Cache = dirty, cache
+	case *nodes2.ExtensionNode:
+		n.Dirty, n.Cache = dirty, cache
+	case *nodes2.BranchNode:
+		n.Dirty, n.Cache = dirty, cache
+	}
+}
+
+// decodeNodeData decodes an RLP-encoded node located at the given path.
+// The path is recorded in the hash nodes referencing its children
+func decodeNodeData(data []byte, path []nibble.Nibble) (nodes2.Node, error) {
 	raw := []interface{}{}
 	if err := rlp.DecodeBytes(data, &raw); err != nil {
 		return nil, err
 	}
 
-	return t.reconstructNode(raw)
+	return reconstructNode(raw, path)
 }
 
-func (t *Trie) reconstructNode(raw []interface{}) (nodes2.Node, error) {
+func reconstructNode(raw []interface{}, nodePath []nibble.Nibble) (nodes2.Node, error) {
 	switch len(raw) {
 	case 2: // Could be LeafNode or ExtensionNode
 		pathBytes, ok := raw[0].([]byte)
@@ -122,17 +302,21 @@ func (t *Trie) reconstructNode(raw []interface{}) (nodes2.Node, error) {
 			return nil, fmt.Errorf("expected raw[0] to be []byte, got %T", raw[0])
 		}
 
+		if len(pathBytes) == 0 {
+			return nil, fmt.Errorf("missing compact encoded path")
+		}
+
 		path := nibble.FromBytes(pathBytes)
 
 		isLeaf := nibble.IsLeaf(path)
 		path = nibble.RemoveCompactEncoding(path)
 
-		valueBytes, ok := raw[1].([]byte)
-		if !ok {
-			return nil, fmt.Errorf("expected raw[1] to be []byte, got %T", raw[1])
-		}
-
 		if isLeaf {
+			valueBytes, ok := raw[1].([]byte)
+			if !ok {
+				return nil, fmt.Errorf("expected raw[1] to be []byte, got %T", raw[1])
+			}
+
 			return &nodes2.LeafNode{
 				Path:  path,
 				Value: valueBytes,
@@ -141,7 +325,7 @@ func (t *Trie) reconstructNode(raw []interface{}) (nodes2.Node, error) {
 		}
 
 		// Handle ExtensionNode's child
-		child, err := t.decodeChild(raw[1])
+		child, err := decodeChild(raw[1], appendPath(nodePath, path))
 		if err != nil {
 			return nil, err
 		}
@@ -155,7 +339,7 @@ func (t *Trie) reconstructNode(raw []interface{}) (nodes2.Node, error) {
 		branch := &nodes2.BranchNode{Dirty: false}
 
 		for i := 0; i < 16; i++ {
-			child, err := t.decodeChild(raw[i])
+			child, err := decodeChild(raw[i], appendPath(nodePath, []nibble.Nibble{nibble.Nibble(i)}))
 			if err != nil {
 				return nil, err
 			}
@@ -169,55 +353,100 @@ func (t *Trie) reconstructNode(raw []interface{}) (nodes2.Node, error) {
 			return nil, fmt.Errorf("expected raw[16] to be []byte, got %T", raw[16])
 		}
 
-		branch.Value = branchBytes
+		// an empty value is encoded the same way as a missing one
+		if len(branchBytes) > 0 {
+			branch.Value = branchBytes
+		}
 
 		return branch, nil
 
 	default:
-		return nil, fmt.Errorf("nknown node type")
+		return nil, fmt.Errorf("unknown node type: list of %d items", len(raw))
 	}
 }
 
-func (t *Trie) decodeChild(data interface{}) (nodes2.Node, error) {
+func decodeChild(data interface{}, path []nibble.Nibble) (nodes2.Node, error) {
 	switch v := data.(type) {
 	case []byte:
-		if len(v) == 32 { // hash length
-			return &nodes2.HashNode{Hash: v}, nil
+		switch len(v) {
+		case 0: // empty child
+			return nil, nil
+		case 32: // hash length
+			return &nodes2.HashNode{Hash: v, Path: path}, nil
+		default:
+			return nil, fmt.Errorf("invalid child reference of %d bytes", len(v))
 		}
-
-		return nil, nil
+	case []interface{}:
+		// a child shorter than 32 bytes is embedded in its parent
+		return reconstructNode(v, path)
 	default:
-		return nil, fmt.Errorf("unexpected child data type")
+		return nil, fmt.Errorf("unexpected child data type %T", data)
 	}
 }
 
-// SetRootHash saves the root hash in the Committer and also in the key-value storage.
+// SetRootHash makes the hash the root of the trie and saves it in the key-value storage.
+// The in-memory nodes and checkpoints are dropped, the root node is loaded on next access
 func (t *Trie) SetRootHash(hash []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if isEmptyRoot(hash) {
+		hash = nil
+	}
+
+	t.root, t.resolved = nil, false
+	t.journal, t.checkpoints = nil, nil
+
+	return t.setRootHash(hash)
+}
+
+// setRootHash saves the root hash in the Committer and also in the key-value storage
+func (t *Trie) setRootHash(hash []byte) error {
 	// Update in-memory representation
 	t.rootHash = hash
 
 	// Persist to the key-value storage
-	err := t.storage.Put([]byte(rootHashKey), hash)
+	err := t.storage.Put(rootPointerKey(t.id), hash)
 	if err != nil {
 		return fmt.Errorf("failed to set root hash in storage: %w", err)
 	}
 
+	// an empty trie has no nodes to keep
+	if t.history > 0 && hash != nil {
+		return t.recordRoot(hash)
+	}
+
 	return nil
 }
 
 // GetRootHash retrieves the root hash from the Committer. If it's not present in memory,
-// it tries to fetch from the key-value storage.
+// it tries to fetch from the key-value storage. A nil hash is returned for an empty trie.
 func (t *Trie) GetRootHash() ([]byte, error) {
-	if t.rootHash != nil {
+	// a trie opened at a given root never follows the stored root pointer
+	if t.rootHash != nil || t.detached {
 		return t.rootHash, nil
 	}
 
 	// If the rootHash is nil, try fetching from the key-value storage
-	value, err := t.storage.Get([]byte(rootHashKey))
+	found, err := t.storage.Has(rootPointerKey(t.id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get root hash from storage: %w", err)
+	}
+
+	if !found {
+		return nil, nil
+	}
+
+	value, err := t.storage.Get(rootPointerKey(t.id))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get root hash from storage: %w", err)
 	}
 
+	// An empty value marks a committed empty trie
+	if len(value) == 0 {
+		return nil, nil
+	}
+
 	// Update in-memory representation
 	t.rootHash = value
 
@@ -0,0 +1,59 @@
+package trie
+
+import (
+	"bytes"
+
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// DerivableList is a list whose root can be derived, such as the transactions,
+// receipts or withdrawals of a block. It has the shape of the go-ethereum type
+type DerivableList interface {
+	Len() int
+	EncodeIndex(i int, w *bytes.Buffer)
+}
+
+// DeriveRoot returns the root of the trie mapping the RLP-encoded index of every
+// item to its encoding, the same as types.DeriveSha of go-ethereum. The items are
+// inserted into a StackTrie in the order of their encoded indexes: 1 to 127, then 0,
+// which is encoded as 0x80, then the multi-byte indexes from 128 on
+func DeriveRoot(list DerivableList) ([]byte, error) {
+	if list.Len() == 0 {
+		return bytes.Clone(EmptyRootHash), nil
+	}
+
+	stackTrie := NewStackTrie(nil)
+
+	var (
+		index []byte
+		value bytes.Buffer
+	)
+
+	insert := func(i int) error {
+		index = rlp.AppendUint64(index[:0], uint64(i))
+
+		value.Reset()
+		list.EncodeIndex(i, &value)
+
+		// the stack trie keeps the value, while the buffer is reused
+		return stackTrie.Put(index, bytes.Clone(value.Bytes()))
+	}
+
+	for i := 1; i < list.Len() && i <= 0x7f; i++ {
+		if err := insert(i); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := insert(0); err != nil {
+		return nil, err
+	}
+
+	for i := 0x80; i < list.Len(); i++ {
+		if err := insert(i); err != nil {
+			return nil, err
+		}
+	}
+
+	return stackTrie.Hash()
+}
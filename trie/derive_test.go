@@ -0,0 +1,80 @@
+package trie
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	ethereumTrie "github.com/ethereum/go-ethereum/trie"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// deriveTestTransactions returns a list mixing legacy and typed transactions
+func deriveTestTransactions(count int) types.Transactions {
+	txs := make(types.Transactions, count)
+
+	for i := range txs {
+		to := common.BigToAddress(big.NewInt(int64(i)))
+
+		if i%2 == 0 {
+			txs[i] = types.NewTx(&types.LegacyTx{
+				Nonce:    uint64(i),
+				GasPrice: big.NewInt(1),
+				Gas:      21000,
+				To:       &to,
+				Value:    big.NewInt(int64(i)),
+			})
+		} else {
+			txs[i] = types.NewTx(&types.DynamicFeeTx{
+				ChainID:   big.NewInt(1),
+				Nonce:     uint64(i),
+				GasTipCap: big.NewInt(1),
+				GasFeeCap: big.NewInt(2),
+				Gas:       21000,
+				To:        &to,
+				Data:      bytes.Repeat([]byte{byte(i)}, i%50),
+			})
+		}
+	}
+
+	return txs
+}
+
+// TestDeriveRootMatchesEthereum tests that list roots match types.DeriveSha of go-ethereum,
+// around the index boundaries where the insertion order changes
+func TestDeriveRootMatchesEthereum(t *testing.T) {
+	t.Parallel()
+
+	for _, count := range []int{0, 1, 2, 127, 128, 129, 300} {
+		txs := deriveTestTransactions(count)
+
+		receipts := make(types.Receipts, count)
+		withdrawals := make(types.Withdrawals, count)
+
+		for i := 0; i < count; i++ {
+			receipts[i] = &types.Receipt{
+				Type:              txs[i].Type(),
+				Status:            types.ReceiptStatusSuccessful,
+				CumulativeGasUsed: uint64(21000 * (i + 1)),
+				Logs:              []*types.Log{},
+			}
+			withdrawals[i] = &types.Withdrawal{
+				Index:     uint64(i),
+				Validator: uint64(i * 3),
+				Address:   common.BigToAddress(big.NewInt(int64(i))),
+				Amount:    uint64(i * 1000),
+			}
+		}
+
+		for _, list := range []types.DerivableList{txs, receipts, withdrawals} {
+			root, err := DeriveRoot(list)
+			require.NoError(t, err)
+
+			expected := types.DeriveSha(list, ethereumTrie.NewStackTrie(nil))
+			assert.Equal(t, expected.Bytes(), root, "%T of %d items", list, count)
+		}
+	}
+}
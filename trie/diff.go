@@ -0,0 +1,216 @@
+package trie
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/Aleksao998/Merkle-Patricia-Trie/storage"
+	"github.com/Aleksao998/Merkle-Patricia-Trie/trie/nibble"
+	nodes2 "github.com/Aleksao998/Merkle-Patricia-Trie/trie/nodes"
+)
+
+// ChangeKind describes how a key changed between two roots
+type ChangeKind int
+
+const (
+	// ChangeInserted means the key is only in the second trie
+	ChangeInserted ChangeKind = iota
+	// ChangeDeleted means the key is only in the first trie
+	ChangeDeleted
+	// ChangeUpdated means the key is in both tries with different values
+	ChangeUpdated
+)
+
+// String returns a human readable name of the change kind
+func (k ChangeKind) String() string {
+	switch k {
+	case ChangeInserted:
+		return "inserted"
+	case ChangeDeleted:
+		return "deleted"
+	case ChangeUpdated:
+		return "updated"
+	default:
+		return fmt.Sprintf("ChangeKind(%d)", int(k))
+	}
+}
+
+// Change is a key that differs between two roots
+type Change struct {
+	Kind ChangeKind
+	Key  []byte
+	// Old is the value under the first root, nil if the key was inserted
+	Old []byte
+	// New is the value under the second root, nil if the key was deleted
+	New []byte
+}
+
+// differ walks two tries at once, comparing the nodes found at the same path
+type differ struct {
+	a, b    *Trie
+	changes []Change
+}
+
+// Diff returns the keys that differ between two committed roots, in key order.
+// Both tries are walked at once, and subtrees stored under the same hash in both
+// tries are skipped without being loaded. An empty root stands for an empty trie.
+// The options select the storage scheme the roots were committed with
+func Diff(db storage.Storage, rootA, rootB []byte, opts ...Option) ([]Change, error) {
+	a, err := NewTrieAt(rootA, db, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := NewTrieAt(rootB, db, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.getRootHash(); err != nil {
+		return nil, err
+	}
+
+	if err := b.getRootHash(); err != nil {
+		return nil, err
+	}
+
+	d := &differ{a: a, b: b}
+	if err := d.diff(a.root, b.root, nil); err != nil {
+		return nil, err
+	}
+
+	return d.changes, nil
+}
+
+// diff compares the nodes located at the given path in both tries
+func (d *differ) diff(a, b nodes2.Node, path []nibble.Nibble) error {
+	// identical subtrees are stored under the same hash
+	if refA, refB := nodeRef(a), nodeRef(b); refA != nil && bytes.Equal(refA, refB) {
+		return nil
+	}
+
+	a, err := d.resolve(d.a, a)
+	if err != nil {
+		return err
+	}
+
+	b, err = d.resolve(d.b, b)
+	if err != nil {
+		return err
+	}
+
+	leafA, isLeafA := a.(*nodes2.LeafNode)
+	leafB, isLeafB := b.(*nodes2.LeafNode)
+
+	switch {
+	case a == nil && b == nil:
+		return nil
+	case isLeafA && (b == nil || isLeafB && nibble.Compare(leafA.Path, leafB.Path) < 0):
+		// the leaf of the first trie comes first, and is not in the second trie
+		if err := d.emit(ChangeDeleted, appendPath(path, leafA.Path), leafA.Value, nil); err != nil {
+			return err
+		}
+
+		return d.diff(nil, b, path)
+	case isLeafB && (a == nil || isLeafA && nibble.Compare(leafB.Path, leafA.Path) < 0):
+		// the leaf of the second trie comes first, and is not in the first trie
+		if err := d.emit(ChangeInserted, appendPath(path, leafB.Path), nil, leafB.Value); err != nil {
+			return err
+		}
+
+		return d.diff(a, nil, path)
+	case isLeafA && isLeafB:
+		// both leaves hold the same key
+		if bytes.Equal(leafA.Value, leafB.Value) {
+			return nil
+		}
+
+		return d.emit(ChangeUpdated, appendPath(path, leafA.Path), leafA.Value, leafB.Value)
+	}
+
+	// the nodes have different shapes, compare them as branches
+	childrenA, valueA := branchView(a)
+	childrenB, valueB := branchView(b)
+
+	if err := d.diffValues(path, valueA, valueB); err != nil {
+		return err
+	}
+
+	for i := 0; i < nodes2.BranchChildrenSize; i++ {
+		if err := d.diff(childrenA[i], childrenB[i], appendPath(path, []nibble.Nibble{nibble.Nibble(i)})); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// diffValues compares the values stored at the given path in both tries
+func (d *differ) diffValues(path []nibble.Nibble, a, b []byte) error {
+	switch {
+	case a == nil && b == nil:
+		return nil
+	case a == nil:
+		return d.emit(ChangeInserted, path, nil, b)
+	case b == nil:
+		return d.emit(ChangeDeleted, path, a, nil)
+	case !bytes.Equal(a, b):
+		return d.emit(ChangeUpdated, path, a, b)
+	default:
+		return nil
+	}
+}
+
+// resolve loads the node referenced by a hash node from the given trie
+func (d *differ) resolve(t *Trie, node nodes2.Node) (nodes2.Node, error) {
+	if hashNode, ok := node.(*nodes2.HashNode); ok {
+		return t.resolve(hashNode)
+	}
+
+	return node, nil
+}
+
+// emit records a change of the key at the given path
+func (d *differ) emit(kind ChangeKind, path []nibble.Nibble, oldValue, newValue []byte) error {
+	if len(path)%2 != 0 {
+		return fmt.Errorf("%w: %v", errOddKeyLength, path)
+	}
+
+	d.changes = append(d.changes, Change{Kind: kind, Key: nibble.ToBytes(path), Old: oldValue, New: newValue})
+
+	return nil
+}
+
+// nodeRef returns the hash a node is stored under, or nil if it is not stored
+func nodeRef(node nodes2.Node) []byte {
+	if hashNode, ok := node.(*nodes2.HashNode); ok {
+		return hashNode.Hash
+	}
+
+	return storedHash(node)
+}
+
+// branchView returns the children and the value of a node as if it were a branch.
+// Leaves and extensions are shortened by the first nibble of their path
+func branchView(node nodes2.Node) ([nodes2.BranchChildrenSize]nodes2.Node, []byte) {
+	var children [nodes2.BranchChildrenSize]nodes2.Node
+
+	switch n := node.(type) {
+	case *nodes2.BranchNode:
+		return n.Children, n.Value
+	case *nodes2.ExtensionNode:
+		if len(n.Path) == 1 {
+			children[n.Path[0]] = n.Node
+		} else {
+			children[n.Path[0]] = &nodes2.ExtensionNode{Path: n.Path[1:], Node: n.Node}
+		}
+	case *nodes2.LeafNode:
+		if len(n.Path) == 0 {
+			return children, n.Value
+		}
+
+		children[n.Path[0]] = &nodes2.LeafNode{Path: n.Path[1:], Value: n.Value}
+	}
+
+	return children, nil
+}
@@ -0,0 +1,170 @@
+package trie
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"testing"
+
+	mockstorage "github.com/Aleksao998/Merkle-Patricia-Trie/storage/mockStorage"
+	"github.com/Aleksao998/Merkle-Patricia-Trie/storage/mpt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// expectedChanges returns the changes between two sets of entries in key order
+func expectedChanges(a, b map[string][]byte) []Change {
+	var changes []Change
+
+	for key, value := range a {
+		newValue, ok := b[key]
+
+		switch {
+		case !ok:
+			changes = append(changes, Change{Kind: ChangeDeleted, Key: []byte(key), Old: value})
+		case !bytes.Equal(value, newValue):
+			changes = append(changes, Change{Kind: ChangeUpdated, Key: []byte(key), Old: value, New: newValue})
+		}
+	}
+
+	for key, value := range b {
+		if _, ok := a[key]; !ok {
+			changes = append(changes, Change{Kind: ChangeInserted, Key: []byte(key), New: value})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return bytes.Compare(changes[i].Key, changes[j].Key) < 0
+	})
+
+	return changes
+}
+
+// commitDiffTestVersions commits two versions of a trie and returns their roots and entries
+func commitDiffTestVersions(t *testing.T, trie *Trie) ([]byte, []byte, map[string][]byte, map[string][]byte) {
+	t.Helper()
+
+	entriesA := make(map[string][]byte)
+
+	// keys of different lengths, some being prefixes of others, so values are held by branches
+	for i := 0; i < 200; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		value := bytes.Repeat([]byte{byte(i)}, i%40+1)
+
+		require.NoError(t, trie.Put(key, value))
+		entriesA[string(key)] = value
+	}
+
+	rootA, err := trie.Commit()
+	require.NoError(t, err)
+
+	entriesB := make(map[string][]byte, len(entriesA))
+	for key, value := range entriesA {
+		entriesB[key] = value
+	}
+
+	for i := 0; i < 200; i += 7 {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		require.NoError(t, trie.Del(key))
+		delete(entriesB, string(key))
+	}
+
+	for i := 3; i < 300; i += 11 {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		value := []byte(fmt.Sprintf("updated-%d", i))
+
+		require.NoError(t, trie.Put(key, value))
+		entriesB[string(key)] = value
+	}
+
+	rootB, err := trie.Commit()
+	require.NoError(t, err)
+
+	return rootA, rootB, entriesA, entriesB
+}
+
+// TestDiff tests that the changes between two roots are returned in key order,
+// in both directions and against an empty trie
+func TestDiff(t *testing.T) {
+	t.Parallel()
+
+	db := mpt.NewMPTMemoryStorage()
+	rootA, rootB, entriesA, entriesB := commitDiffTestVersions(t, NewTrie(db))
+
+	changes, err := Diff(db, rootA, rootB)
+	require.NoError(t, err)
+	require.NotEmpty(t, changes)
+	assert.Equal(t, expectedChanges(entriesA, entriesB), changes)
+
+	changes, err = Diff(db, rootB, rootA)
+	require.NoError(t, err)
+	assert.Equal(t, expectedChanges(entriesB, entriesA), changes)
+
+	changes, err = Diff(db, nil, rootA)
+	require.NoError(t, err)
+	assert.Equal(t, expectedChanges(nil, entriesA), changes)
+
+	changes, err = Diff(db, rootA, rootA)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+
+	_, err = Diff(db, rootA, bytes.Repeat([]byte{1}, 32))
+	assert.ErrorIs(t, err, errRootNotFound)
+}
+
+// TestDiffSkipsEqualSubtrees tests that subtrees with equal hashes are not loaded
+func TestDiffSkipsEqualSubtrees(t *testing.T) {
+	t.Parallel()
+
+	memory := mpt.NewMPTMemoryStorage()
+	reads := 0
+	db := &mockstorage.MockStorage{
+		HasFn: memory.Has,
+		PutFn: memory.Put,
+		GetFn: func(key []byte) ([]byte, error) {
+			reads++
+
+			return memory.Get(key)
+		},
+	}
+
+	trie := NewTrie(db)
+
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, trie.Put([]byte(fmt.Sprintf("key-%d", i)), bytes.Repeat([]byte{byte(i)}, 32)))
+	}
+
+	rootA, err := trie.Commit()
+	require.NoError(t, err)
+
+	require.NoError(t, trie.Put([]byte("key-500"), []byte("updated")))
+
+	rootB, err := trie.Commit()
+	require.NoError(t, err)
+
+	reads = 0
+
+	changes, err := Diff(db, rootA, rootB)
+	require.NoError(t, err)
+	assert.Equal(t, []Change{{
+		Kind: ChangeUpdated,
+		Key:  []byte("key-500"),
+		Old:  bytes.Repeat([]byte{byte(500 % 256)}, 32),
+		New:  []byte("updated"),
+	}}, changes)
+
+	// only the nodes on the path of the updated key are loaded from both tries
+	assert.Less(t, reads, 20)
+}
+
+// TestDiffPathScheme tests the diff of two versions committed with the path scheme
+func TestDiffPathScheme(t *testing.T) {
+	t.Parallel()
+
+	db := newMapStorage(make(map[string][]byte))
+	rootA, rootB, entriesA, entriesB := commitDiffTestVersions(t, NewTrie(db, WithPathScheme(1)))
+
+	changes, err := Diff(db, rootA, rootB, WithPathScheme(1))
+	require.NoError(t, err)
+	assert.Equal(t, expectedChanges(entriesA, entriesB), changes)
+}
@@ -1,73 +1,125 @@
 package trie
 
 import (
+	"fmt"
+
 	"github.com/Aleksao998/Merkle-Patricia-Trie/trie/crypto"
 	"github.com/Aleksao998/Merkle-Patricia-Trie/trie/nibble"
 	nodes2 "github.com/Aleksao998/Merkle-Patricia-Trie/trie/nodes"
 	"github.com/ethereum/go-ethereum/rlp"
 )
 
-func (t *Trie) NodeHash(node nodes2.Node) []byte {
-	rlp, err := rlp.EncodeToBytes(t.NodeRaw(node, true))
+// NodeHash returns the hash of the node. Hashes and encodings are cached on the nodes,
+// so only the nodes modified since the last call are encoded and hashed again
+func (t *Trie) NodeHash(node nodes2.Node) ([]byte, error) {
+	if hashNode, ok := node.(*nodes2.HashNode); ok {
+		return hashNode.Hash, nil
+	}
+
+	cache := nodes2.CacheOf(node)
+	if cache != nil && cache.Hash != nil {
+		return cache.Hash, nil
+	}
+
+	encoded, err := t.encodeNode(node)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	return crypto.Keccak256(rlp)
+	hash := crypto.Keccak256(encoded)
+
+	// the hash of a clean node marks it as stored, so it is only set on commit or load
+	if cache != nil && isDirty(node) {
+		cache.Hash = hash
+	}
+
+	return hash, nil
 }
 
-func (t *Trie) NodeRaw(node nodes2.Node, forHashing bool) interface{} {
+// NodeRaw returns the raw representation of the node, ready for RLP encoding.
+// Children are referenced by their hash, or embedded if their encoding is shorter than 32 bytes
+func (t *Trie) NodeRaw(node nodes2.Node) (interface{}, error) {
 	switch n := node.(type) {
 	case nil:
-		return []byte{}
+		return []byte{}, nil
 	case *nodes2.LeafNode:
 		return []interface{}{
 			nibble.ToBytes(nibble.CompactEncoding(n.Path, true)),
 			n.Value,
-		}
+		}, nil
 	case *nodes2.ExtensionNode:
-		nextData := t.NodeRaw(n.Node, forHashing)
-
-		encodedNextData, _ := rlp.EncodeToBytes(nextData)
-		if len(encodedNextData) >= 32 {
-			nextData = t.NodeHash(n.Node)
+		nextData, err := t.childRaw(n.Node)
+		if err != nil {
+			return nil, err
 		}
 
 		return []interface{}{
 			nibble.ToBytes(nibble.CompactEncoding(n.Path, false)),
 			nextData,
-		}
+		}, nil
 	case *nodes2.BranchNode:
 		var childHashes [16]interface{}
 
 		for i, child := range n.Children {
-			if child != nil {
-				childData := t.NodeRaw(child, forHashing)
-
-				encodedChildData, _ := rlp.EncodeToBytes(childData)
-				if len(encodedChildData) >= 32 {
-					childHashes[i] = t.NodeHash(child)
-				} else {
-					childHashes[i] = childData
-				}
-			} else {
-				childHashes[i] = []byte{}
+			childData, err := t.childRaw(child)
+			if err != nil {
+				return nil, err
 			}
+
+			childHashes[i] = childData
 		}
 
-		return append(childHashes[:], n.Value)
+		return append(childHashes[:], n.Value), nil
 	case *nodes2.HashNode:
-		if !forHashing {
-			return n.Hash // just return the hash if we're hashing
-		}
+		return n.Hash, nil
+	default:
+		return nil, fmt.Errorf("%w: %T", errUnexpectedNode, node)
+	}
+}
 
-		actualNode, err := t.DecodeNode(n.Hash)
-		if err != nil {
-			panic(err)
-		}
+// encodeNode returns the RLP encoding of the node, from its cache if it is still valid
+func (t *Trie) encodeNode(node nodes2.Node) ([]byte, error) {
+	cache := nodes2.CacheOf(node)
+	if cache != nil && cache.Encoded != nil {
+		return cache.Encoded, nil
+	}
 
-		return t.NodeRaw(actualNode, forHashing)
-	default:
-		panic("Unknown node type")
+	raw, err := t.NodeRaw(node)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded, err := rlp.EncodeToBytes(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode node: %w", err)
 	}
+
+	if cache != nil {
+		cache.Encoded = encoded
+	}
+
+	return encoded, nil
+}
+
+// childRaw returns the raw representation of a child as embedded in its parent:
+// the child encoding if it is shorter than 32 bytes, its hash otherwise
+func (t *Trie) childRaw(child nodes2.Node) (interface{}, error) {
+	switch n := child.(type) {
+	case nil:
+		return []byte{}, nil
+	case *nodes2.HashNode:
+		// a committed child is already referenced by its hash
+		return n.Hash, nil
+	}
+
+	encoded, err := t.encodeNode(child)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(encoded) >= 32 {
+		return t.NodeHash(child)
+	}
+
+	return rlp.RawValue(encoded), nil
 }
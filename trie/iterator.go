@@ -0,0 +1,278 @@
+package trie
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Aleksao998/Merkle-Patricia-Trie/trie/nibble"
+	nodes2 "github.com/Aleksao998/Merkle-Patricia-Trie/trie/nodes"
+)
+
+var errOddKeyLength = errors.New("key has an odd number of nibbles")
+
+// iteratorFrame is a node on the iterator traversal stack together with
+// the nibble path leading to it and the traversal progress inside it.
+// For branch nodes index is -1 until the branch value has been visited,
+// after that it is the next child to descend into
+type iteratorFrame struct {
+	node  nodes2.Node
+	path  []nibble.Nibble
+	index int
+}
+
+// Iterator walks the key/value pairs of a trie in lexicographic key order.
+// Committed subtrees are resolved lazily from storage. The trie must not be
+// modified while it is being iterated
+type Iterator struct {
+	trie  *Trie
+	root  nodes2.Node
+	stack []*iteratorFrame
+	key   []byte
+	value []byte
+	err   error
+}
+
+// NewIterator returns an iterator positioned before the first key of the trie
+func (t *Trie) NewIterator() *Iterator {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.newIterator()
+}
+
+// newIterator returns an iterator positioned before the first key, the trie lock has to be held
+func (t *Trie) newIterator() *Iterator {
+	it := &Iterator{trie: t}
+
+	if err := t.getRootHash(); err != nil {
+		it.err = err
+
+		return it
+	}
+
+	it.root = t.root
+	it.push(it.root, nil)
+
+	return it
+}
+
+// Next moves the iterator to the next key/value pair.
+// It returns false when the iteration is exhausted or an error occurred
+func (it *Iterator) Next() bool {
+	it.trie.mu.RLock()
+	defer it.trie.mu.RUnlock()
+
+	return it.next()
+}
+
+// next moves the iterator to the next key/value pair, the trie lock has to be held
+func (it *Iterator) next() bool {
+	if it.err != nil {
+		return false
+	}
+
+	for len(it.stack) > 0 {
+		frame := it.stack[len(it.stack)-1]
+
+		switch node := frame.node.(type) {
+		case nil:
+			it.pop()
+		case *nodes2.HashNode:
+			actualNode, err := it.trie.resolve(node)
+			if err != nil {
+				return it.fail(err)
+			}
+
+			frame.node = actualNode
+		case *nodes2.LeafNode:
+			it.pop()
+
+			return it.emit(appendPath(frame.path, node.Path), node.Value)
+		case *nodes2.ExtensionNode:
+			it.pop()
+			it.push(node.Node, appendPath(frame.path, node.Path))
+		case *nodes2.BranchNode:
+			// the branch value is shorter than every key below the branch, so it comes first
+			if frame.index == -1 {
+				frame.index = 0
+
+				if value, found := node.GetValue(); found {
+					return it.emit(frame.path, value)
+				}
+			}
+
+			// find the next non-empty child, or leave the branch if there is none
+			for frame.index < nodes2.BranchChildrenSize && node.Children[frame.index] == nil {
+				frame.index++
+			}
+
+			if frame.index == nodes2.BranchChildrenSize {
+				it.pop()
+
+				continue
+			}
+
+			child := frame.index
+			frame.index++
+
+			it.push(node.Children[child], appendPath(frame.path, []nibble.Nibble{nibble.Nibble(child)}))
+		default:
+			return it.fail(fmt.Errorf("%w: %T", errUnexpectedNode, node))
+		}
+	}
+
+	it.key, it.value = nil, nil
+
+	return false
+}
+
+// Seek repositions the iterator so that the following call to Next
+// moves to the first key that is greater than or equal to start
+func (it *Iterator) Seek(start []byte) {
+	it.trie.mu.RLock()
+	defer it.trie.mu.RUnlock()
+
+	it.seek(start)
+}
+
+// seek repositions the iterator before the start key, the trie lock has to be held
+func (it *Iterator) seek(start []byte) {
+	// the trie root could not be loaded, there is nothing to seek in
+	if it.err != nil && it.root == nil {
+		return
+	}
+
+	it.stack = it.stack[:0]
+	it.key, it.value, it.err = nil, nil, nil
+
+	currentNode := it.root
+	remaining := nibble.FromBytes(start)
+
+	var path []nibble.Nibble
+
+	// descend along the start path, keeping on the stack only the parts of the
+	// trie that hold keys greater than or equal to start
+	for {
+		switch node := currentNode.(type) {
+		case nil:
+			return
+		case *nodes2.HashNode:
+			actualNode, err := it.trie.resolve(node)
+			if err != nil {
+				it.fail(err)
+
+				return
+			}
+
+			currentNode = actualNode
+		case *nodes2.LeafNode:
+			if nibble.Compare(node.Path, remaining) >= 0 {
+				it.push(node, path)
+			}
+
+			return
+		case *nodes2.ExtensionNode:
+			commonLength := nibble.CommonPrefixLength(node.Path, remaining)
+
+			switch {
+			case commonLength == len(node.Path):
+				// the extension is a prefix of the remaining path, keep descending
+				path = appendPath(path, node.Path)
+				remaining = remaining[commonLength:]
+				currentNode = node.Node
+			case commonLength == len(remaining) || node.Path[commonLength] > remaining[commonLength]:
+				// every key below the extension is greater than start
+				it.push(node, path)
+
+				return
+			default:
+				// every key below the extension is smaller than start
+				return
+			}
+		case *nodes2.BranchNode:
+			if len(remaining) == 0 {
+				it.push(node, path)
+
+				return
+			}
+
+			// the branch value and the children before the start nibble are smaller than start
+			child := remaining[0]
+			it.stack = append(it.stack, &iteratorFrame{node: node, path: path, index: int(child) + 1})
+
+			path = appendPath(path, []nibble.Nibble{child})
+			remaining = remaining[1:]
+			currentNode = node.Children[child]
+		default:
+			it.fail(fmt.Errorf("%w: %T", errUnexpectedNode, node))
+
+			return
+		}
+	}
+}
+
+// Key returns the key of the current key/value pair
+func (it *Iterator) Key() []byte {
+	return it.key
+}
+
+// Value returns the value of the current key/value pair
+func (it *Iterator) Value() []byte {
+	return it.value
+}
+
+// Err returns the error that stopped the iteration, if any
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// All returns the remaining key/value pairs as a push iterator that has the
+// shape of iter.Seq2[[]byte, []byte]. Err should be checked once it returns
+func (it *Iterator) All() func(yield func(key, value []byte) bool) {
+	return func(yield func(key, value []byte) bool) {
+		for it.Next() {
+			if !yield(it.Key(), it.Value()) {
+				return
+			}
+		}
+	}
+}
+
+// push adds a node to the traversal stack
+func (it *Iterator) push(node nodes2.Node, path []nibble.Nibble) {
+	it.stack = append(it.stack, &iteratorFrame{node: node, path: path, index: -1})
+}
+
+// pop removes the top node from the traversal stack
+func (it *Iterator) pop() {
+	it.stack = it.stack[:len(it.stack)-1]
+}
+
+// emit sets the current key/value pair
+func (it *Iterator) emit(path []nibble.Nibble, value []byte) bool {
+	if len(path)%2 != 0 {
+		return it.fail(fmt.Errorf("%w: %v", errOddKeyLength, path))
+	}
+
+	it.key = nibble.ToBytes(path)
+	it.value = value
+
+	return true
+}
+
+// fail stops the iteration with the given error
+func (it *Iterator) fail(err error) bool {
+	it.err = err
+	it.stack = nil
+	it.key, it.value = nil, nil
+
+	return false
+}
+
+// appendPath returns a new nibble path made of the prefix followed by the suffix
+func appendPath(prefix, suffix []nibble.Nibble) []nibble.Nibble {
+	path := make([]nibble.Nibble, 0, len(prefix)+len(suffix))
+	path = append(path, prefix...)
+
+	return append(path, suffix...)
+}
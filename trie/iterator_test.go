@@ -0,0 +1,195 @@
+package trie
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"strconv"
+	"testing"
+
+	mockstorage "github.com/Aleksao998/Merkle-Patricia-Trie/storage/mockStorage"
+	"github.com/Aleksao998/Merkle-Patricia-Trie/storage/mpt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// iteratorTestKeys returns keys covering leaf, extension and branch values
+func iteratorTestKeys() [][]byte {
+	keys := [][]byte{
+		[]byte("do"), []byte("dog"), []byte("doge"), []byte("dogglesworth"),
+		[]byte("cat"), []byte("car"), []byte("c"), []byte("horse"),
+	}
+
+	for i := 0; i < 50; i++ {
+		keys = append(keys, []byte("key"+strconv.Itoa(i)))
+	}
+
+	return keys
+}
+
+// collect drains the iterator into a list of keys and a map of values
+func collect(t *testing.T, it *Iterator) ([][]byte, map[string][]byte) {
+	t.Helper()
+
+	var keys [][]byte
+
+	values := make(map[string][]byte)
+
+	for it.Next() {
+		keys = append(keys, it.Key())
+		values[string(it.Key())] = it.Value()
+	}
+
+	require.NoError(t, it.Err())
+
+	return keys, values
+}
+
+// TestIteratorOrder tests that the iterator visits every key in lexicographic order,
+// both for in-memory tries and for partially committed tries
+func TestIteratorOrder(t *testing.T) {
+	t.Parallel()
+
+	keys := iteratorTestKeys()
+
+	expected := make([][]byte, len(keys))
+	copy(expected, keys)
+	sort.Slice(expected, func(i, j int) bool { return bytes.Compare(expected[i], expected[j]) < 0 })
+
+	db := mpt.NewMPTMemoryStorage()
+	trie := NewTrie(db)
+
+	for i, key := range keys {
+		require.NoError(t, trie.Put(key, key))
+
+		// commit half way to mix hash nodes with in-memory nodes
+		if i == len(keys)/2 {
+			_, err := trie.Commit()
+			require.NoError(t, err)
+		}
+	}
+
+	gotKeys, values := collect(t, trie.NewIterator())
+	assert.Equal(t, expected, gotKeys)
+
+	for _, key := range keys {
+		assert.Equal(t, key, values[string(key)])
+	}
+
+	_, err := trie.Commit()
+	require.NoError(t, err)
+
+	gotKeys, _ = collect(t, NewTrie(db).NewIterator())
+	assert.Equal(t, expected, gotKeys)
+}
+
+// TestIteratorSeek tests that seeking positions the iterator at the first key
+// greater than or equal to the start key
+func TestIteratorSeek(t *testing.T) {
+	t.Parallel()
+
+	db := mpt.NewMPTMemoryStorage()
+	trie := NewTrie(db)
+
+	for _, key := range iteratorTestKeys() {
+		require.NoError(t, trie.Put(key, key))
+	}
+
+	_, err := trie.Commit()
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name  string
+		start []byte
+		first []byte
+	}{
+		{"nil start", nil, []byte("c")},
+		{"exact branch value", []byte("do"), []byte("do")},
+		{"between keys", []byte("dogf"), []byte("dogglesworth")},
+		{"inside extension", []byte("ho"), []byte("horse")},
+		{"before leaf", []byte("car"), []byte("car")},
+		{"after every key", []byte("z"), nil},
+	}
+
+	for _, tt := range testCases {
+		it := trie.NewIterator()
+		it.Seek(tt.start)
+
+		if tt.first == nil {
+			assert.False(t, it.Next(), tt.name)
+
+			continue
+		}
+
+		require.True(t, it.Next(), tt.name)
+		assert.Equal(t, tt.first, it.Key(), tt.name)
+
+		// every following key must be strictly increasing
+		previous := it.Key()
+		for it.Next() {
+			assert.Equal(t, 1, bytes.Compare(it.Key(), previous), tt.name)
+			previous = it.Key()
+		}
+
+		require.NoError(t, it.Err())
+	}
+}
+
+// TestIteratorAll tests the push iterator adapter and early termination
+func TestIteratorAll(t *testing.T) {
+	t.Parallel()
+
+	trie := NewTrie(&mockstorage.MockStorage{})
+
+	for _, key := range iteratorTestKeys() {
+		require.NoError(t, trie.Put(key, key))
+	}
+
+	var visited [][]byte
+
+	it := trie.NewIterator()
+	it.All()(func(key, value []byte) bool {
+		visited = append(visited, key)
+
+		return len(visited) < 3
+	})
+
+	require.NoError(t, it.Err())
+	assert.Equal(t, [][]byte{[]byte("c"), []byte("car"), []byte("cat")}, visited)
+}
+
+// TestIteratorStorageError tests that a failing storage read stops the iteration with an error
+func TestIteratorStorageError(t *testing.T) {
+	t.Parallel()
+
+	db := mpt.NewMPTMemoryStorage()
+	trie := NewTrie(db)
+
+	for _, key := range iteratorTestKeys() {
+		require.NoError(t, trie.Put(key, key))
+	}
+
+	_, err := trie.Commit()
+	require.NoError(t, err)
+
+	errStorage := errors.New("storage unavailable")
+	reads := 0
+
+	failing := &mockstorage.MockStorage{
+		HasFn: db.Has,
+		GetFn: func(key []byte) ([]byte, error) {
+			reads++
+			if reads > 3 {
+				return nil, errStorage
+			}
+
+			return db.Get(key)
+		},
+	}
+
+	it := NewTrie(failing).NewIterator()
+	for it.Next() {
+	}
+
+	require.ErrorIs(t, it.Err(), errStorage)
+}
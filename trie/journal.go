@@ -0,0 +1,86 @@
+package trie
+
+import (
+	"errors"
+
+	nodes2 "github.com/Aleksao998/Merkle-Patricia-Trie/trie/nodes"
+)
+
+var errInvalidCheckpoint = errors.New("invalid checkpoint")
+
+// journalEntry records a node pointer replaced after a checkpoint, along with its previous node
+type journalEntry struct {
+	node *nodes2.Node
+	prev nodes2.Node
+}
+
+// Checkpoint records the current state of the trie and returns its id, which RevertTo
+// rolls back to. While a checkpoint is held, Put and Del copy the nodes they modify
+// instead of updating them in place, so reverting restores the original nodes and their
+// cached hashes. Checkpoints are discarded by Commit
+func (t *Trie) Checkpoint() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.checkpoints = append(t.checkpoints, len(t.journal))
+
+	return len(t.checkpoints) - 1
+}
+
+// RevertTo undoes every Put and Del made since the given checkpoint was taken.
+// The checkpoint and the later ones are released, earlier ones can still be reverted to
+func (t *Trie) RevertTo(id int) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if id < 0 || id >= len(t.checkpoints) {
+		return errInvalidCheckpoint
+	}
+
+	mark := t.checkpoints[id]
+
+	// undo the replacements in reverse order
+	for i := len(t.journal) - 1; i >= mark; i-- {
+		*t.journal[i].node = t.journal[i].prev
+	}
+
+	t.journal = t.journal[:mark]
+	t.checkpoints = t.checkpoints[:id]
+
+	return nil
+}
+
+// replaceNode sets the node pointer, recording its previous node while a checkpoint is held
+func (t *Trie) replaceNode(node *nodes2.Node, replacement nodes2.Node) {
+	if len(t.checkpoints) > 0 {
+		t.journal = append(t.journal, journalEntry{node: node, prev: *node})
+	}
+
+	*node = replacement
+}
+
+// mutableBranch returns the branch node referenced by the pointer, ready to be modified.
+// While a checkpoint is held, the pointer is replaced with a copy of the node
+func (t *Trie) mutableBranch(node *nodes2.Node, branch *nodes2.BranchNode) *nodes2.BranchNode {
+	if len(t.checkpoints) == 0 {
+		return branch
+	}
+
+	branchCopy := *branch
+	t.replaceNode(node, &branchCopy)
+
+	return &branchCopy
+}
+
+// mutableExtension returns the extension node referenced by the pointer, ready to be modified.
+// While a checkpoint is held, the pointer is replaced with a copy of the node
+func (t *Trie) mutableExtension(node *nodes2.Node, extension *nodes2.ExtensionNode) *nodes2.ExtensionNode {
+	if len(t.checkpoints) == 0 {
+		return extension
+	}
+
+	extensionCopy := *extension
+	t.replaceNode(node, &extensionCopy)
+
+	return &extensionCopy
+}
@@ -0,0 +1,137 @@
+package trie
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Aleksao998/Merkle-Patricia-Trie/storage/mpt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// applyJournalTestUpdates updates and deletes keys of the trie, and inserts new ones
+func applyJournalTestUpdates(t *testing.T, trie *Trie, round int) {
+	t.Helper()
+
+	for i := 0; i < 100; i++ {
+		key := []byte(fmt.Sprintf("key-%d", (i*7+round)%150))
+
+		if i%3 == 0 {
+			err := trie.Del(key)
+			if err != nil {
+				require.ErrorIs(t, err, ErrKeyNotFound)
+			}
+
+			continue
+		}
+
+		require.NoError(t, trie.Put(key, []byte(fmt.Sprintf("value-%d-%d", round, i))))
+	}
+}
+
+// requireTrieState checks the root hash and the values of the trie
+func requireTrieState(t *testing.T, trie *Trie, hash []byte, values map[string][]byte) {
+	t.Helper()
+
+	got, err := trie.Hash()
+	require.NoError(t, err)
+	require.Equal(t, hash, got)
+
+	for key, value := range values {
+		got, err := trie.Get([]byte(key))
+		require.NoError(t, err)
+		require.Equal(t, value, got)
+	}
+}
+
+// snapshotValues returns the values of all keys of the trie
+func snapshotValues(t *testing.T, trie *Trie) map[string][]byte {
+	t.Helper()
+
+	values := make(map[string][]byte)
+
+	for it := trie.NewIterator(); it.Next(); {
+		values[string(it.Key())] = it.Value()
+	}
+
+	return values
+}
+
+// TestCheckpointRevert tests that reverting to nested checkpoints restores identical root hashes,
+// both for committed nodes and for nodes only held in memory
+func TestCheckpointRevert(t *testing.T) {
+	t.Parallel()
+
+	trie := NewTrie(mpt.NewMPTMemoryStorage())
+
+	for i := 0; i < 100; i++ {
+		require.NoError(t, trie.Put([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("value-%d", i))))
+	}
+
+	_, err := trie.Commit()
+	require.NoError(t, err)
+
+	// uncommitted updates on top of the committed trie
+	applyJournalTestUpdates(t, trie, 0)
+
+	hash0, err := trie.Hash()
+	require.NoError(t, err)
+
+	values0 := snapshotValues(t, trie)
+	first := trie.Checkpoint()
+
+	applyJournalTestUpdates(t, trie, 1)
+
+	hash1, err := trie.Hash()
+	require.NoError(t, err)
+	require.NotEqual(t, hash0, hash1)
+
+	values1 := snapshotValues(t, trie)
+	second := trie.Checkpoint()
+
+	applyJournalTestUpdates(t, trie, 2)
+
+	require.NoError(t, trie.RevertTo(second))
+	requireTrieState(t, trie, hash1, values1)
+
+	require.NoError(t, trie.RevertTo(first))
+	requireTrieState(t, trie, hash0, values0)
+
+	// released checkpoints can not be reverted to
+	assert.ErrorIs(t, trie.RevertTo(second), errInvalidCheckpoint)
+	assert.ErrorIs(t, trie.RevertTo(first), errInvalidCheckpoint)
+
+	// the reverted trie commits the same root as a trie built without the reverted updates
+	expected := NewTrie(mpt.NewMPTMemoryStorage())
+	for key, value := range values0 {
+		require.NoError(t, expected.Put([]byte(key), value))
+	}
+
+	expectedRoot, err := expected.Commit()
+	require.NoError(t, err)
+
+	root, err := trie.Commit()
+	require.NoError(t, err)
+	assert.Equal(t, expectedRoot, root)
+}
+
+// TestCommitDiscardsCheckpoints tests that checkpoints can not be reverted to after a commit
+func TestCommitDiscardsCheckpoints(t *testing.T) {
+	t.Parallel()
+
+	trie := NewTrie(mpt.NewMPTMemoryStorage())
+	require.NoError(t, trie.Put([]byte("key"), []byte("value")))
+
+	checkpoint := trie.Checkpoint()
+	require.NoError(t, trie.Put([]byte("key"), []byte("updated")))
+
+	_, err := trie.Commit()
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, trie.RevertTo(checkpoint), errInvalidCheckpoint)
+	assert.ErrorIs(t, trie.RevertTo(-1), errInvalidCheckpoint)
+
+	value, err := trie.Get([]byte("key"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("updated"), value)
+}
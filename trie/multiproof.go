@@ -0,0 +1,181 @@
+package trie
+
+import (
+	"fmt"
+
+	"github.com/Aleksao998/Merkle-Patricia-Trie/storage"
+	"github.com/Aleksao998/Merkle-Patricia-Trie/storage/mpt"
+	"github.com/Aleksao998/Merkle-Patricia-Trie/trie/nibble"
+	nodes2 "github.com/Aleksao998/Merkle-Patricia-Trie/trie/nodes"
+)
+
+// keyPath is the remaining nibble path of one of the keys of a multi-key traversal
+type keyPath struct {
+	index int
+	path  []nibble.Nibble
+}
+
+// ProveMany returns a single proof for all the given keys. The trie is traversed once
+// and every node shared by the paths of several keys is stored in the proof only once.
+// Keys that are not in the trie are proven absent
+func (t *Trie) ProveMany(keys [][]byte) (storage.Storage, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.getRootHash(); err != nil {
+		return nil, err
+	}
+
+	db := mpt.NewMPTMemoryStorage()
+
+	if err := t.proveManyInto(db, t.root, toKeyPaths(keys), true); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// proveManyInto stores every node on the paths of the given keys in the proof storage
+func (t *Trie) proveManyInto(db storage.Storage, node nodes2.Node, paths []keyPath, isRoot bool) error {
+	if len(paths) == 0 {
+		return nil
+	}
+
+	if hashNode, ok := node.(*nodes2.HashNode); ok {
+		actualNode, err := t.resolve(hashNode)
+		if err != nil {
+			return err
+		}
+
+		node = actualNode
+	}
+
+	switch n := node.(type) {
+	case nil:
+		return nil
+	case *nodes2.LeafNode:
+		return t.storeNode(db, n, isRoot)
+	case *nodes2.ExtensionNode:
+		if err := t.storeNode(db, n, isRoot); err != nil {
+			return err
+		}
+
+		return t.proveManyInto(db, n.Node, descendExtension(n, paths), false)
+	case *nodes2.BranchNode:
+		if err := t.storeNode(db, n, isRoot); err != nil {
+			return err
+		}
+
+		for child, childPaths := range descendBranch(paths) {
+			if err := t.proveManyInto(db, n.Children[child], childPaths, false); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("%w: %T", errUnexpectedNode, n)
+	}
+}
+
+// VerifyProofs checks a multi-key proof against the root hash in a single pass over the proof.
+// It returns the proven value of every key, nil for the keys proven absent.
+// ErrInvalidProof is returned if the proof cannot be trusted for any of the keys
+func VerifyProofs(rootHash []byte, keys [][]byte, proof storage.Storage) ([][]byte, error) {
+	values := make([][]byte, len(keys))
+
+	// an empty trie holds no keys
+	if isEmptyRoot(rootHash) {
+		return values, nil
+	}
+
+	if err := verifyManyProofs(proof, nodes2.NewHashNode(rootHash), toKeyPaths(keys), values); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// verifyManyProofs walks the proof along the paths of the given keys and records their values
+func verifyManyProofs(proof storage.Storage, node nodes2.Node, paths []keyPath, values [][]byte) error {
+	if len(paths) == 0 {
+		return nil
+	}
+
+	if hashNode, ok := node.(*nodes2.HashNode); ok {
+		actualNode, err := verifiedProofNode(proof, hashNode.Hash)
+		if err != nil {
+			return err
+		}
+
+		node = actualNode
+	}
+
+	switch n := node.(type) {
+	case nil:
+		return nil
+	case *nodes2.LeafNode:
+		for _, p := range paths {
+			if nibble.Equal(n.Path, p.path) {
+				values[p.index] = n.Value
+			}
+		}
+
+		return nil
+	case *nodes2.ExtensionNode:
+		return verifyManyProofs(proof, n.Node, descendExtension(n, paths), values)
+	case *nodes2.BranchNode:
+		for _, p := range paths {
+			if len(p.path) == 0 {
+				values[p.index] = n.Value
+			}
+		}
+
+		for child, childPaths := range descendBranch(paths) {
+			if err := verifyManyProofs(proof, n.Children[child], childPaths, values); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("%w: %T", errUnexpectedNode, n)
+	}
+}
+
+// toKeyPaths converts keys to nibble paths, remembering their position
+func toKeyPaths(keys [][]byte) []keyPath {
+	paths := make([]keyPath, 0, len(keys))
+
+	for i, key := range keys {
+		paths = append(paths, keyPath{index: i, path: nibble.FromBytes(key)})
+	}
+
+	return paths
+}
+
+// descendExtension returns the paths that continue below the extension node
+func descendExtension(n *nodes2.ExtensionNode, paths []keyPath) []keyPath {
+	var childPaths []keyPath
+
+	for _, p := range paths {
+		if nibble.CommonPrefixLength(n.Path, p.path) == len(n.Path) {
+			childPaths = append(childPaths, keyPath{index: p.index, path: p.path[len(n.Path):]})
+		}
+	}
+
+	return childPaths
+}
+
+// descendBranch groups the paths that continue below the branch node by child nibble
+func descendBranch(paths []keyPath) [nodes2.BranchChildrenSize][]keyPath {
+	var childPaths [nodes2.BranchChildrenSize][]keyPath
+
+	for _, p := range paths {
+		if len(p.path) > 0 {
+			childPaths[p.path[0]] = append(childPaths[p.path[0]], keyPath{index: p.index, path: p.path[1:]})
+		}
+	}
+
+	return childPaths
+}
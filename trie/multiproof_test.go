@@ -0,0 +1,92 @@
+package trie
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/Aleksao998/Merkle-Patricia-Trie/storage/mpt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingStorage counts the number of writes made to a proof storage
+type countingStorage struct {
+	*mpt.MPTMemoryStorage
+	puts int
+}
+
+func (c *countingStorage) Put(key []byte, value []byte) error {
+	c.puts++
+
+	return c.MPTMemoryStorage.Put(key, value)
+}
+
+// TestProveMany tests that a multi-key proof proves every key and stores shared nodes once
+func TestProveMany(t *testing.T) {
+	t.Parallel()
+
+	trie := NewTrie(mpt.NewMPTMemoryStorage())
+
+	var keys [][]byte
+
+	for i := 0; i < 200; i++ {
+		key := []byte(fmt.Sprintf("account-%03d", i))
+		keys = append(keys, key)
+
+		require.NoError(t, trie.Put(key, bytes.Repeat(key, 3)))
+	}
+
+	_, err := trie.Commit()
+	require.NoError(t, err)
+
+	root, err := trie.Hash()
+	require.NoError(t, err)
+
+	requested := append([][]byte{}, keys[10:60]...)
+	requested = append(requested, []byte("missing"), []byte("account-999"))
+
+	proof, err := trie.ProveMany(requested)
+	require.NoError(t, err)
+
+	values, err := VerifyProofs(root, requested, proof)
+	require.NoError(t, err)
+	require.Len(t, values, len(requested))
+
+	for i, key := range requested[:50] {
+		assert.Equal(t, bytes.Repeat(key, 3), values[i])
+	}
+
+	assert.Nil(t, values[50])
+	assert.Nil(t, values[51])
+
+	// every node of the multi-key proof is written once
+	counting := &countingStorage{MPTMemoryStorage: mpt.NewMPTMemoryStorage()}
+	require.NoError(t, trie.proveManyInto(counting, trie.root, toKeyPaths(requested), true))
+
+	separate := 0
+
+	for _, key := range requested {
+		single := &countingStorage{MPTMemoryStorage: mpt.NewMPTMemoryStorage()}
+		_, _ = trie.proveInto(single, trie.root, key)
+		separate += single.puts
+	}
+
+	assert.Less(t, counting.puts, separate)
+}
+
+// TestVerifyProofsInvalid tests that a multi-key proof missing a node is rejected
+func TestVerifyProofsInvalid(t *testing.T) {
+	t.Parallel()
+
+	trie, _ := newProofTestTrie(t)
+
+	root, err := trie.Hash()
+	require.NoError(t, err)
+
+	proof, err := trie.ProveMany([][]byte{[]byte("dog")})
+	require.NoError(t, err)
+
+	_, err = VerifyProofs(root, [][]byte{[]byte("dog"), []byte("horse")}, proof)
+	require.ErrorIs(t, err, ErrInvalidProof)
+}
@@ -46,6 +46,27 @@ func Equal(n1, n2 []Nibble) bool {
 	return true
 }
 
+// Compare returns an integer comparing two nibble slices lexicographically.
+// The result is 0 if n1 == n2, -1 if n1 < n2, and +1 if n1 > n2
+func Compare(n1, n2 []Nibble) int {
+	commonLength := CommonPrefixLength(n1, n2)
+
+	switch {
+	case commonLength < len(n1) && commonLength < len(n2):
+		if n1[commonLength] < n2[commonLength] {
+			return -1
+		}
+
+		return 1
+	case len(n1) < len(n2):
+		return -1
+	case len(n1) > len(n2):
+		return 1
+	default:
+		return 0
+	}
+}
+
 // CompactEncoding adds a nibble prefix to a slice of nibbles to indicate its type and make its length even
 func CompactEncoding(ns []Nibble, isLeafNode bool) []Nibble {
 	var prefix []Nibble
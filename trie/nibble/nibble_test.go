@@ -76,6 +76,29 @@ func TestEqual(t *testing.T) {
 	}
 }
 
+// TestCompare tests the lexicographic ordering of two slices of Nibbles
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name     string
+		node1    []Nibble
+		node2    []Nibble
+		expected int
+	}{
+		{"Equal nibbles", []Nibble{0xA, 0xB}, []Nibble{0xA, 0xB}, 0},
+		{"Both empty slices", []Nibble{}, []Nibble{}, 0},
+		{"Smaller nibble", []Nibble{0xA, 0x1}, []Nibble{0xA, 0x2}, -1},
+		{"Greater nibble", []Nibble{0xB}, []Nibble{0xA, 0xF}, 1},
+		{"Prefix is smaller", []Nibble{0xA}, []Nibble{0xA, 0x0}, -1},
+		{"Longer is greater", []Nibble{0xA, 0x0}, []Nibble{0xA}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Compare(tt.node1, tt.node2))
+		})
+	}
+}
+
 // TestCompactEncoding tests the CompactEncoding function
 func TestCompactEncoding(t *testing.T) {
 	tests := []struct {
@@ -11,6 +11,7 @@ type BranchNode struct {
 	Value      []byte
 	childCount int
 	Dirty      bool
+	Cache
 }
 
 func NewBranchNode() *BranchNode {
@@ -20,9 +21,15 @@ func NewBranchNode() *BranchNode {
 	}
 }
 
+// MarkDirty flags the node as modified and drops its cached encoding and hash
+func (b *BranchNode) MarkDirty() {
+	b.Dirty = true
+	b.Cache = Cache{}
+}
+
 // SetValue sets value for branch node
 func (b *BranchNode) SetValue(value []byte) {
-	b.Dirty = true
+	b.MarkDirty()
 	b.Value = value
 }
 
@@ -39,7 +46,7 @@ func (b *BranchNode) GetValue() (value []byte, exists bool) {
 func (b *BranchNode) SetChild(nibble nibble.Nibble, node Node) {
 	if int(nibble) < BranchChildrenSize {
 		// If the child is being set to nil, and it previously existed, decrement childCount
-		b.Dirty = true
+		b.MarkDirty()
 		b.Children[int(nibble)] = node
 	} else {
 		panic("Invalid nibble for BranchNode")
@@ -66,6 +73,6 @@ func (b *BranchNode) HasValue() bool {
 
 // ClearValue clears value
 func (b *BranchNode) ClearValue() {
-	b.Dirty = true
+	b.MarkDirty()
 	b.Value = nil
 }
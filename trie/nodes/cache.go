@@ -0,0 +1,22 @@
+package nodes
+
+// Cache holds the RLP encoding and the hash of a node once they are computed.
+// Both are dropped as soon as the node is modified
+type Cache struct {
+	Encoded []byte
+	Hash    []byte // for a clean node, the hash the node is stored under
+}
+
+// CacheOf returns the cache of a leaf, extension or branch node, or nil for other nodes
+func CacheOf(node Node) *Cache {
+	switch n := node.(type) {
+	case *LeafNode:
+		return &n.Cache
+	case *ExtensionNode:
+		return &n.Cache
+	case *BranchNode:
+		return &n.Cache
+	default:
+		return nil
+	}
+}
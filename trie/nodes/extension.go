@@ -8,6 +8,7 @@ type ExtensionNode struct {
 	Path  []nibble.Nibble
 	Node  Node
 	Dirty bool
+	Cache
 }
 
 func NewExtension(path []nibble.Nibble, node Node) *ExtensionNode {
@@ -17,3 +18,9 @@ func NewExtension(path []nibble.Nibble, node Node) *ExtensionNode {
 		Dirty: true,
 	}
 }
+
+// MarkDirty flags the node as modified and drops its cached encoding and hash
+func (e *ExtensionNode) MarkDirty() {
+	e.Dirty = true
+	e.Cache = Cache{}
+}
@@ -1,7 +1,12 @@
 package nodes
 
+import (
+	"github.com/Aleksao998/Merkle-Patricia-Trie/trie/nibble"
+)
+
 type HashNode struct {
 	Hash []byte
+	Path []nibble.Nibble // absolute path of the referenced node, used by the path storage scheme
 }
 
 func NewHashNode(hash []byte) *HashNode {
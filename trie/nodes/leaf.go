@@ -8,6 +8,7 @@ type LeafNode struct {
 	Path  []nibble.Nibble
 	Value []byte
 	Dirty bool
+	Cache
 }
 
 func NewLeafNode(path []nibble.Nibble, value []byte) *LeafNode {
@@ -17,3 +18,9 @@ func NewLeafNode(path []nibble.Nibble, value []byte) *LeafNode {
 		Dirty: true,
 	}
 }
+
+// MarkDirty flags the node as modified and drops its cached encoding and hash
+func (l *LeafNode) MarkDirty() {
+	l.Dirty = true
+	l.Cache = Cache{}
+}
@@ -0,0 +1,49 @@
+package trie
+
+// Option configures a trie on construction
+type Option func(*Trie)
+
+// WithID stores the root pointer of the trie under its own key, so several tries
+// can share one storage. Tries without ID share the default root pointer
+func WithID(id string) Option {
+	return func(t *Trie) {
+		t.id = id
+	}
+}
+
+// WithParallelHashing hashes and commits the subtrees near the top of the trie
+// with a pool of at most the given number of workers. The root hash is the same as
+// with sequential hashing. The committed nodes are written in a single batch if the
+// storage implements storage.Batcher, or by concurrent writes otherwise, so the storage
+// has to be safe for concurrent use. The path scheme still commits sequentially
+func WithParallelHashing(workers int) Option {
+	return func(t *Trie) {
+		t.workers = workers
+	}
+}
+
+// WithPathScheme stores the nodes under the trie ID and their nibble path instead of their
+// hash, keeping only the latest version of every node. Each commit writes a reverse diff,
+// so the given number of previous versions can still be opened with NewTrieAt
+func WithPathScheme(history int) Option {
+	return func(t *Trie) {
+		t.paths = newPathStore(history)
+	}
+}
+
+// WithRootHistory records the given number of most recent roots committed as the head
+// of the trie, so that pruning can keep them along with the head, see HeadRoots
+func WithRootHistory(roots int) Option {
+	return func(t *Trie) {
+		t.history = roots
+	}
+}
+
+// WithoutEthereumParity restores the former semantics of empty tries and values:
+// an empty trie hashes to nil instead of EmptyRootHash, and empty values are stored
+// instead of deleting their key
+func WithoutEthereumParity() Option {
+	return func(t *Trie) {
+		t.legacy = true
+	}
+}
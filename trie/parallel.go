@@ -0,0 +1,243 @@
+package trie
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/Aleksao998/Merkle-Patricia-Trie/storage"
+	"github.com/Aleksao998/Merkle-Patricia-Trie/trie/nibble"
+	nodes2 "github.com/Aleksao998/Merkle-Patricia-Trie/trie/nodes"
+)
+
+// parallelDepth is the number of branch levels below the root whose children are hashed
+// and committed concurrently. Deeper subtrees are handled by the worker that owns them
+const parallelDepth = 2
+
+// nodeBatch collects the nodes stored by a parallel commit, to write them once the trie is committed.
+// It also records how the commit changed the trie, so the changes can be undone if the write fails
+type nodeBatch struct {
+	mu     sync.Mutex
+	keys   [][]byte
+	values [][]byte
+	undo   []func()
+}
+
+// put adds a node to the batch, it is safe for concurrent use
+func (b *nodeBatch) put(key, value []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.keys = append(b.keys, key)
+	b.values = append(b.values, value)
+}
+
+// record adds a function undoing a change of the trie made by the commit, it is safe for concurrent use
+func (b *nodeBatch) record(undo func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.undo = append(b.undo, undo)
+}
+
+// rollback undoes the changes of the commit in reverse order
+func (b *nodeBatch) rollback() {
+	for i := len(b.undo) - 1; i >= 0; i-- {
+		b.undo[i]()
+	}
+}
+
+// hashParallel computes and caches the hashes of the modified subtrees of the node using the worker pool
+func (t *Trie) hashParallel(node nodes2.Node) error {
+	if t.workers < 2 {
+		return nil
+	}
+
+	// the calling goroutine counts as a worker
+	pool := make(chan struct{}, t.workers-1)
+
+	return t.hashSubtree(node, pool, 0)
+}
+
+// hashSubtree hashes a modified subtree. The children of the branch nodes down to parallelDepth
+// are handed to the worker pool, or hashed by the calling goroutine when every worker is busy
+func (t *Trie) hashSubtree(node nodes2.Node, pool chan struct{}, depth int) error {
+	if !isDirty(node) {
+		return nil
+	}
+
+	switch n := node.(type) {
+	case *nodes2.ExtensionNode:
+		if err := t.hashSubtree(n.Node, pool, depth); err != nil {
+			return err
+		}
+	case *nodes2.BranchNode:
+		if depth < parallelDepth {
+			err := eachDirtyChild(n, pool, func(_ int, child nodes2.Node) error {
+				return t.hashSubtree(child, pool, depth+1)
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := t.NodeHash(node)
+
+	return err
+}
+
+// commitParallel commits the root node and its subtree like commit, committing the modified
+// subtrees near the top of the trie with the worker pool. The new nodes are collected while
+// committing and written at the end, see writeBatch. If anything fails, the committed nodes are
+// left dirty and in place, so the next commit stores them. Only the hash scheme is supported
+func (t *Trie) commitParallel(root nodes2.Node) ([]byte, error) {
+	t.batch = &nodeBatch{}
+	defer func() {
+		t.batch = nil
+	}()
+
+	// the calling goroutine counts as a worker
+	pool := make(chan struct{}, t.workers-1)
+
+	if err := t.commitSubtrees(root, nil, pool, 0); err != nil {
+		t.batch.rollback()
+
+		return nil, err
+	}
+
+	// the top levels, whose children are committed by now, are committed sequentially
+	hash, err := t.commit(root)
+	if err != nil {
+		t.batch.rollback()
+
+		return nil, err
+	}
+
+	if err := t.writeBatch(t.batch); err != nil {
+		t.batch.rollback()
+
+		return nil, err
+	}
+
+	return hash, nil
+}
+
+// commitSubtrees commits the modified children of the branch nodes at parallelDepth below the
+// node at the given path, using the worker pool. The nodes above them are left to commit
+func (t *Trie) commitSubtrees(node nodes2.Node, path []nibble.Nibble, pool chan struct{}, depth int) error {
+	if !isDirty(node) {
+		return nil
+	}
+
+	switch n := node.(type) {
+	case *nodes2.ExtensionNode:
+		return t.commitSubtrees(n.Node, appendPath(path, n.Path), pool, depth)
+	case *nodes2.BranchNode:
+		return eachDirtyChild(n, pool, func(index int, child nodes2.Node) error {
+			childPath := appendPath(path, []nibble.Nibble{nibble.Nibble(index)})
+
+			if depth+1 < parallelDepth {
+				return t.commitSubtrees(child, childPath, pool, depth+1)
+			}
+
+			// every goroutine replaces a different child of the branch
+			committedChild, err := t.commitChild(child, childPath)
+			if err != nil {
+				return err
+			}
+
+			t.setChild(&n.Children[index], committedChild)
+
+			return nil
+		})
+	default:
+		return nil
+	}
+}
+
+// writeBatch writes the nodes collected by a parallel commit in a single write if the storage
+// implements storage.Batcher, or with concurrent writes spread over the workers otherwise
+func (t *Trie) writeBatch(batch *nodeBatch) error {
+	if len(batch.keys) == 0 {
+		return nil
+	}
+
+	if batcher, ok := t.storage.(storage.Batcher); ok {
+		if err := batcher.PutBatch(batch.keys, batch.values); err != nil {
+			return fmt.Errorf("failed to store nodes: %w", err)
+		}
+
+		return nil
+	}
+
+	var wg sync.WaitGroup
+
+	errs := make([]error, t.workers)
+
+	for worker := 0; worker < t.workers; worker++ {
+		wg.Add(1)
+
+		go func(worker int) {
+			defer wg.Done()
+
+			for i := worker; i < len(batch.keys); i += t.workers {
+				if err := t.storage.Put(batch.keys[i], batch.values[i]); err != nil {
+					errs[worker] = fmt.Errorf("failed to store node %x: %w", batch.keys[i], err)
+
+					return
+				}
+			}
+		}(worker)
+	}
+
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// eachDirtyChild calls fn for the modified children of the branch node concurrently. The children
+// are handed to the worker pool, or handled by the calling goroutine when every worker is busy
+func eachDirtyChild(n *nodes2.BranchNode, pool chan struct{}, fn func(index int, child nodes2.Node) error) error {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+
+	run := func(index int, child nodes2.Node) {
+		if err := fn(index, child); err != nil {
+			mu.Lock()
+			if firstErr == nil {
+				firstErr = err
+			}
+			mu.Unlock()
+		}
+	}
+
+	for index, child := range n.Children {
+		if !isDirty(child) {
+			continue
+		}
+
+		select {
+		case pool <- struct{}{}:
+			wg.Add(1)
+
+			go func(index int, child nodes2.Node) {
+				defer func() {
+					<-pool
+					wg.Done()
+				}()
+
+				run(index, child)
+			}(index, child)
+		default:
+			run(index, child)
+		}
+	}
+
+	wg.Wait()
+
+	return firstErr
+}
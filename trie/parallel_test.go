@@ -0,0 +1,228 @@
+package trie
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/Aleksao998/Merkle-Patricia-Trie/storage"
+	"github.com/Aleksao998/Merkle-Patricia-Trie/storage/mpt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingStorage is a memory storage recording the written pairs, safe for concurrent use
+type recordingStorage struct {
+	*mpt.MPTMemoryStorage
+	mu    sync.Mutex
+	pairs map[string][]byte
+	err   error // returned by the writes while set
+}
+
+func newRecordingStorage() *recordingStorage {
+	return &recordingStorage{
+		MPTMemoryStorage: mpt.NewMPTMemoryStorage(),
+		pairs:            make(map[string][]byte),
+	}
+}
+
+func (s *recordingStorage) Put(key []byte, value []byte) error {
+	s.mu.Lock()
+	if s.err != nil {
+		s.mu.Unlock()
+
+		return s.err
+	}
+
+	s.pairs[string(key)] = append([]byte{}, value...)
+	s.mu.Unlock()
+
+	return s.MPTMemoryStorage.Put(key, value)
+}
+
+// failWrites makes the writes return the given error, or succeed again if it is nil
+func (s *recordingStorage) failWrites(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.err = err
+}
+
+// batchStorage is a recording storage implementing storage.Batcher, counting the batches
+type batchStorage struct {
+	*recordingStorage
+	batches int
+}
+
+func (s *batchStorage) PutBatch(keys, values [][]byte) error {
+	return s.WriteBatch(nil, keys, values)
+}
+
+func (s *batchStorage) WriteBatch(deletes, keys, values [][]byte) error {
+	s.batches++
+
+	// a failing batch writes nothing
+	s.mu.Lock()
+	err := s.err
+	s.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	for _, key := range deletes {
+		if err := s.Delete(key); err != nil {
+			return err
+		}
+	}
+
+	for i := range keys {
+		if err := s.Put(keys[i], values[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// TestParallelHashing tests that hashing and committing with a worker pool
+// produces the same root hashes and stored nodes as the sequential path,
+// whether the nodes are written in a batch or by concurrent writes
+func TestParallelHashing(t *testing.T) {
+	t.Parallel()
+
+	sequentialDB := newRecordingStorage()
+	parallelDB := newRecordingStorage()
+	batchDB := &batchStorage{recordingStorage: newRecordingStorage()}
+
+	sequential := NewTrie(sequentialDB)
+	parallel := NewTrie(parallelDB, WithParallelHashing(4))
+	batched := NewTrie(batchDB, WithParallelHashing(4))
+
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 400; i++ {
+			key := []byte(fmt.Sprintf("key-%d", (i*31+round*7)%1000))
+			value := bytes.Repeat([]byte{byte(i), byte(round)}, i%20+1)
+
+			require.NoError(t, sequential.Put(key, value))
+			require.NoError(t, parallel.Put(key, value))
+			require.NoError(t, batched.Put(key, value))
+		}
+
+		for i := 0; i < 50; i++ {
+			key := []byte(fmt.Sprintf("key-%d", (i*13+round)%1000))
+
+			// both tries hold the same keys, so they agree on which deletions fail
+			deleted := sequential.Del(key) == nil
+			assert.Equal(t, deleted, parallel.Del(key) == nil)
+			assert.Equal(t, deleted, batched.Del(key) == nil)
+		}
+
+		expectedHash, err := sequential.Hash()
+		require.NoError(t, err)
+
+		hash, err := parallel.Hash()
+		require.NoError(t, err)
+		require.Equal(t, expectedHash, hash, "round %d", round)
+
+		expectedRoot, err := sequential.Commit()
+		require.NoError(t, err)
+
+		root, err := parallel.Commit()
+		require.NoError(t, err)
+		require.Equal(t, expectedRoot, root, "round %d", round)
+
+		root, err = batched.Commit()
+		require.NoError(t, err)
+		require.Equal(t, expectedRoot, root, "round %d", round)
+		require.Equal(t, round+1, batchDB.batches)
+
+		require.Equal(t, sequentialDB.pairs, parallelDB.pairs, "round %d", round)
+		require.Equal(t, sequentialDB.pairs, batchDB.pairs, "round %d", round)
+	}
+
+	reloaded := NewTrie(parallelDB)
+
+	it := NewTrie(sequentialDB).NewIterator()
+	for it.Next() {
+		value, err := reloaded.Get(it.Key())
+		require.NoError(t, err)
+		assert.Equal(t, it.Value(), value)
+	}
+
+	require.NoError(t, it.Err())
+}
+
+// TestParallelCommitWriteFailure tests that a parallel commit whose nodes cannot be written
+// leaves the trie unchanged, so that committing again stores all of them
+func TestParallelCommitWriteFailure(t *testing.T) {
+	t.Parallel()
+
+	errWrite := errors.New("write failed")
+	plainDB := newRecordingStorage()
+	batchDB := &batchStorage{recordingStorage: newRecordingStorage()}
+
+	testCases := []struct {
+		name      string
+		db        storage.Storage
+		recording *recordingStorage
+	}{
+		{"concurrent writes", plainDB, plainDB},
+		{"batch write", batchDB, batchDB.recordingStorage},
+	}
+
+	for _, tt := range testCases {
+		trie := NewTrie(tt.db, WithParallelHashing(4))
+		expected := NewTrie(mpt.NewMPTMemoryStorage())
+		pairs := make(map[string][]byte)
+
+		put := func(key string, value []byte) {
+			require.NoError(t, trie.Put([]byte(key), value))
+			require.NoError(t, expected.Put([]byte(key), value))
+			pairs[key] = value
+		}
+
+		for i := 0; i < 300; i++ {
+			put(fmt.Sprintf("key-%d", i), bytes.Repeat([]byte{byte(i)}, i%40+1))
+		}
+
+		_, err := trie.Commit()
+		require.NoError(t, err, tt.name)
+
+		// the first commit leaves clean subtrees next to the modified ones
+		for i := 0; i < 300; i += 3 {
+			put(fmt.Sprintf("key-%d", i), bytes.Repeat([]byte{byte(i), 1}, i%30+1))
+		}
+
+		tt.recording.failWrites(errWrite)
+
+		_, err = trie.Commit()
+		require.ErrorIs(t, err, errWrite, tt.name)
+
+		// the trie is still readable from memory
+		for key, value := range pairs {
+			stored, err := trie.Get([]byte(key))
+			require.NoError(t, err, tt.name)
+			assert.Equal(t, value, stored, tt.name)
+		}
+
+		tt.recording.failWrites(nil)
+
+		expectedRoot, err := expected.Commit()
+		require.NoError(t, err)
+
+		root, err := trie.Commit()
+		require.NoError(t, err, tt.name)
+		require.Equal(t, expectedRoot, root, tt.name)
+
+		reloaded := NewTrie(tt.db)
+
+		for key, value := range pairs {
+			stored, err := reloaded.Get([]byte(key))
+			require.NoError(t, err, tt.name)
+			assert.Equal(t, value, stored, tt.name)
+		}
+	}
+}
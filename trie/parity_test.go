@@ -0,0 +1,205 @@
+package trie
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/Aleksao998/Merkle-Patricia-Trie/storage/mpt"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	ethereumTrie "github.com/ethereum/go-ethereum/trie"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEmptyValueDeletes tests that inserting an empty value deletes the key,
+// and that the root is the same as the one of go-ethereum
+func TestEmptyValueDeletes(t *testing.T) {
+	t.Parallel()
+
+	trie := NewTrie(mpt.NewMPTMemoryStorage())
+	ethTrie := ethereumTrie.NewEmpty(ethereumTrie.NewDatabase(rawdb.NewMemoryDatabase(), nil))
+
+	for i := 0; i < 50; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		value := []byte(fmt.Sprintf("value-%d", i))
+
+		require.NoError(t, trie.Put(key, value))
+		ethTrie.MustUpdate(key, value)
+	}
+
+	for i := 0; i < 50; i += 3 {
+		key := []byte(fmt.Sprintf("key-%d", i))
+
+		require.NoError(t, trie.Put(key, []byte{}))
+		ethTrie.MustUpdate(key, []byte{})
+
+		_, err := trie.Get(key)
+		require.ErrorIs(t, err, ErrKeyNotFound)
+	}
+
+	// deleting a missing key with an empty value is not an error
+	require.NoError(t, trie.Put([]byte("missing"), nil))
+
+	// inserting the same value again leaves the trie untouched
+	require.NoError(t, trie.Put([]byte("key-1"), []byte("value-1")))
+	ethTrie.MustUpdate([]byte("key-1"), []byte("value-1"))
+
+	root, err := trie.Hash()
+	require.NoError(t, err)
+	assert.Equal(t, ethTrie.Hash().Bytes(), root)
+}
+
+// TestRandomUpdatesMatchEthereum tests that random inserts and deletes of keys of different
+// lengths, many being prefixes of others, give the same roots as go-ethereum
+func TestRandomUpdatesMatchEthereum(t *testing.T) {
+	t.Parallel()
+
+	r := rand.New(rand.NewSource(1))
+	trie := NewTrie(mpt.NewMPTMemoryStorage())
+	ethTrie := ethereumTrie.NewEmpty(ethereumTrie.NewDatabase(rawdb.NewMemoryDatabase(), nil))
+
+	for i := 0; i < 3000; i++ {
+		// short keys over few nibbles, so branches end up holding values
+		key := make([]byte, r.Intn(4))
+		for j := range key {
+			key[j] = byte(r.Intn(3)<<4 | r.Intn(3))
+		}
+
+		var value []byte
+		if r.Intn(3) > 0 {
+			value = []byte(fmt.Sprintf("value-%d", i))
+		}
+
+		if value == nil && r.Intn(2) == 0 {
+			if err := trie.Del(key); err != nil {
+				require.ErrorIs(t, err, ErrKeyNotFound)
+			}
+		} else {
+			require.NoError(t, trie.Put(key, value))
+		}
+
+		ethTrie.MustUpdate(key, value)
+
+		root, err := trie.Hash()
+		require.NoError(t, err)
+		require.Equal(t, ethTrie.Hash().Bytes(), root, "update %d", i)
+
+		if i%500 == 0 {
+			_, err := trie.Commit()
+			require.NoError(t, err)
+		}
+	}
+}
+
+// TestEmptyRootHash tests that an emptied trie hashes to EmptyRootHash,
+// which opens an empty trie and proves every key absent
+func TestEmptyRootHash(t *testing.T) {
+	t.Parallel()
+
+	db := mpt.NewMPTMemoryStorage()
+	trie := NewTrie(db)
+
+	require.NoError(t, trie.Put([]byte("key"), []byte("value")))
+
+	_, err := trie.Commit()
+	require.NoError(t, err)
+
+	// the committed root is not loaded again once the last key is deleted
+	require.NoError(t, trie.Del([]byte("key")))
+
+	root, err := trie.Hash()
+	require.NoError(t, err)
+	assert.Equal(t, types.EmptyRootHash.Bytes(), root)
+
+	root, err = trie.Commit()
+	require.NoError(t, err)
+	assert.Equal(t, EmptyRootHash, root)
+
+	root, err = NewTrie(db).Hash()
+	require.NoError(t, err)
+	assert.Equal(t, EmptyRootHash, root)
+
+	empty, err := NewTrieAt(EmptyRootHash, db)
+	require.NoError(t, err)
+
+	_, err = empty.Get([]byte("key"))
+	require.ErrorIs(t, err, ErrKeyNotFound)
+
+	proof, err := empty.Proof([]byte("key"))
+	require.ErrorIs(t, err, ErrKeyNotFound)
+
+	_, err = VerifyProof(EmptyRootHash, []byte("key"), proof)
+	assert.ErrorIs(t, err, ErrKeyAbsent)
+}
+
+// TestWithoutEthereumParity tests that the former semantics of empty tries and values are kept
+func TestWithoutEthereumParity(t *testing.T) {
+	t.Parallel()
+
+	trie := NewTrie(mpt.NewMPTMemoryStorage(), WithoutEthereumParity())
+
+	root, err := trie.Hash()
+	require.NoError(t, err)
+	assert.Nil(t, root)
+
+	require.NoError(t, trie.Put([]byte("key"), []byte{}))
+
+	value, err := trie.Get([]byte("key"))
+	require.NoError(t, err)
+	assert.Empty(t, value)
+
+	require.NoError(t, trie.Del([]byte("key")))
+
+	root, err = trie.Commit()
+	require.NoError(t, err)
+	assert.Nil(t, root)
+}
+
+// TestRangeProofWithoutEthereumParity tests that the range proofs of a trie holding empty values
+// are verified with the options of the trie
+func TestRangeProofWithoutEthereumParity(t *testing.T) {
+	t.Parallel()
+
+	trie := NewTrie(mpt.NewMPTMemoryStorage(), WithoutEthereumParity())
+
+	rangeProof := &RangeProof{}
+
+	hasMore, err := VerifyRangeProof(nil, nil, rangeProof, WithoutEthereumParity())
+	require.NoError(t, err)
+	assert.False(t, hasMore)
+
+	for i := 0; i < 20; i++ {
+		value := []byte{}
+		if i%3 != 0 {
+			value = []byte(fmt.Sprintf("value-%02d", i))
+		}
+
+		require.NoError(t, trie.Put([]byte(fmt.Sprintf("key-%02d", i)), value))
+	}
+
+	root, err := trie.Commit()
+	require.NoError(t, err)
+
+	rangeProof, err = trie.ProveRange([]byte("key-05"), 5)
+	require.NoError(t, err)
+	require.Len(t, rangeProof.Keys, 5)
+
+	hasMore, err = VerifyRangeProof(root, []byte("key-05"), rangeProof, WithoutEthereumParity())
+	require.NoError(t, err)
+	assert.True(t, hasMore)
+
+	// with Ethereum parity an empty value would delete its key
+	_, err = VerifyRangeProof(root, []byte("key-05"), rangeProof)
+	assert.ErrorIs(t, err, errInvalidRange)
+
+	rangeProof, err = trie.ProveRange(nil, 20)
+	require.NoError(t, err)
+
+	rangeProof.Proof = nil
+
+	hasMore, err = VerifyRangeProof(root, nil, rangeProof, WithoutEthereumParity())
+	require.NoError(t, err)
+	assert.False(t, hasMore)
+}
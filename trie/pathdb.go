@@ -0,0 +1,478 @@
+package trie
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/Aleksao998/Merkle-Patricia-Trie/storage"
+	"github.com/Aleksao998/Merkle-Patricia-Trie/trie/crypto"
+	"github.com/Aleksao998/Merkle-Patricia-Trie/trie/nibble"
+	nodes2 "github.com/Aleksao998/Merkle-Patricia-Trie/trie/nodes"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	// pathNodePrefix prefixes the storage keys of the nodes stored by path
+	pathNodePrefix = "pathNode/"
+
+	// pathDiffPrefix prefixes the storage keys of the reverse diffs
+	pathDiffPrefix = "pathDiff/"
+
+	// pathDiffHeadPrefix prefixes the storage key of the sequence number of the latest reverse diff
+	pathDiffHeadPrefix = "pathDiffHead/"
+)
+
+var (
+	errStalePathNode = errors.New("node stored at path does not match the referenced hash")
+	errReadOnlyTrie  = errors.New("historical trie of the path scheme is read-only")
+)
+
+// pathStore stores the nodes of a trie under their owner and nibble path.
+// Only the latest version of every node is kept, older versions of the trie are
+// reconstructed from the reverse diffs written by each commit
+type pathStore struct {
+	storage storage.Storage
+	owner   string // trie ID the nodes are stored under
+	history int    // number of reverse diffs kept, older versions can not be opened
+
+	// overlay holds the nodes of a historical version by storage key, an empty
+	// value marks a missing node. It is nil when the latest version is read
+	overlay map[string][]byte
+
+	// nodes written and deleted by the running commit, by storage key
+	writes  map[string][]byte
+	deletes map[string]struct{}
+}
+
+// pathDiff is persisted by each commit and restores the previous version of the nodes it touched
+type pathDiff struct {
+	Root   []byte   // root hash of the previous version
+	Keys   [][]byte // storage keys of the touched nodes
+	Values [][]byte // previous values of the nodes, empty if missing
+}
+
+func newPathStore(history int) *pathStore {
+	return &pathStore{
+		history: history,
+	}
+}
+
+// nodeKey returns the storage key of the node at the given path
+func (p *pathStore) nodeKey(path []nibble.Nibble) []byte {
+	key := make([]byte, 0, len(pathNodePrefix)+len(p.owner)+1+len(path))
+	key = append(key, pathNodePrefix+p.owner+"/"...)
+
+	for _, n := range path {
+		key = append(key, byte(n))
+	}
+
+	return key
+}
+
+// diffKey returns the storage key of the reverse diff with the given sequence number
+func (p *pathStore) diffKey(seq uint64) []byte {
+	return binary.BigEndian.AppendUint64([]byte(pathDiffPrefix+p.owner+"/"), seq)
+}
+
+// headKey returns the storage key of the sequence number of the latest reverse diff
+func (p *pathStore) headKey() []byte {
+	return []byte(pathDiffHeadPrefix + p.owner)
+}
+
+// get returns the value stored under the key, or nil if there is none
+func (p *pathStore) get(key []byte) ([]byte, error) {
+	found, err := p.storage.Has(key)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	return p.storage.Get(key)
+}
+
+// readNode returns the encoding of the node at the given path and checks it against the expected hash
+func (p *pathStore) readNode(path []nibble.Nibble, hash []byte) ([]byte, error) {
+	key := p.nodeKey(path)
+
+	data, ok := p.overlay[string(key)]
+	if !ok {
+		var err error
+
+		if data, err = p.get(key); err != nil {
+			return nil, err
+		}
+	}
+
+	if !bytes.Equal(crypto.Keccak256(data), hash) {
+		return nil, fmt.Errorf("%w: path %x", errStalePathNode, key[len(key)-len(path):])
+	}
+
+	return data, nil
+}
+
+// latestRoot returns the hash of the latest root node, or nil if the trie is empty
+func (p *pathStore) latestRoot() ([]byte, error) {
+	data, err := p.get(p.nodeKey(nil))
+	if err != nil || len(data) == 0 {
+		return nil, err
+	}
+
+	return crypto.Keccak256(data), nil
+}
+
+// openAt prepares reading the version of the trie with the given root, by applying
+// the reverse diffs from the newest to the oldest until the version is reached
+func (p *pathStore) openAt(root []byte) error {
+	latest, err := p.latestRoot()
+	if err != nil {
+		return fmt.Errorf("failed to load root node %x: %w", root, err)
+	}
+
+	if bytes.Equal(latest, root) {
+		return nil
+	}
+
+	head, err := p.head()
+	if err != nil {
+		return err
+	}
+
+	overlay := make(map[string][]byte)
+
+	for seq := head; seq > 0 && head-seq < uint64(p.history); seq-- {
+		diff, err := p.loadDiff(seq)
+		if err != nil {
+			return err
+		}
+
+		if diff == nil {
+			break
+		}
+
+		for i, key := range diff.Keys {
+			overlay[string(key)] = diff.Values[i]
+		}
+
+		if bytes.Equal(diff.Root, root) {
+			p.overlay = overlay
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %x", errRootNotFound, root)
+}
+
+// head returns the sequence number of the latest reverse diff, 0 if none was written
+func (p *pathStore) head() (uint64, error) {
+	data, err := p.get(p.headKey())
+	if err != nil {
+		return 0, fmt.Errorf("failed to load reverse diff head: %w", err)
+	}
+
+	if len(data) == 0 {
+		return 0, nil
+	}
+
+	return binary.BigEndian.Uint64(data), nil
+}
+
+// loadDiff returns the reverse diff with the given sequence number, or nil if it was dropped
+func (p *pathStore) loadDiff(seq uint64) (*pathDiff, error) {
+	data, err := p.get(p.diffKey(seq))
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	diff := new(pathDiff)
+	if err := rlp.DecodeBytes(data, diff); err != nil {
+		return nil, fmt.Errorf("failed to decode reverse diff %d: %w", seq, err)
+	}
+
+	return diff, nil
+}
+
+// stage schedules the write of the node encoding at the given path
+func (p *pathStore) stage(path []nibble.Nibble, encoded []byte) {
+	if p.writes == nil {
+		p.writes = make(map[string][]byte)
+	}
+
+	p.writes[string(p.nodeKey(path))] = encoded
+}
+
+// replace schedules the deletion of the stored nodes made stale by the committed node at
+// the given path, whose children are already committed. A nil node removes the whole subtree
+func (p *pathStore) replace(path []nibble.Nibble, node nodes2.Node) error {
+	old, err := p.get(p.nodeKey(path))
+	if err != nil || old == nil {
+		return err
+	}
+
+	if node == nil {
+		return p.deleteStale(path, nil, path)
+	}
+
+	oldNode, err := decodeNodeData(old, path)
+	if err != nil {
+		return fmt.Errorf("failed to decode node at path %x: %w", path, err)
+	}
+
+	for _, child := range childPaths(oldNode, nil) {
+		if err := p.deleteStale(child, node, path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteStale schedules the deletion of the stored node at the given path and of its
+// descendants, unless they are still stored in the committed subtree rooted at root
+func (p *pathStore) deleteStale(path []nibble.Nibble, root nodes2.Node, rootPath []nibble.Nibble) error {
+	stored, err := p.isStoredAt(root, rootPath, path)
+	if err != nil || stored {
+		return err
+	}
+
+	key := p.nodeKey(path)
+
+	old, err := p.get(key)
+	if err != nil || old == nil {
+		return err
+	}
+
+	if p.deletes == nil {
+		p.deletes = make(map[string]struct{})
+	}
+
+	p.deletes[string(key)] = struct{}{}
+
+	oldNode, err := decodeNodeData(old, path)
+	if err != nil {
+		return fmt.Errorf("failed to decode node at path %x: %w", path, err)
+	}
+
+	for _, child := range childPaths(oldNode, nil) {
+		if err := p.deleteStale(child, root, rootPath); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// flush writes the staged nodes along with the reverse diff restoring their previous version,
+// in a single write if the storage implements storage.Batcher
+func (p *pathStore) flush() error {
+	defer func() {
+		p.writes, p.deletes = nil, nil
+	}()
+
+	if len(p.writes) == 0 && len(p.deletes) == 0 {
+		return nil
+	}
+
+	root, err := p.latestRoot()
+	if err != nil {
+		return fmt.Errorf("failed to load root node: %w", err)
+	}
+
+	diff := &pathDiff{Root: root}
+
+	for key := range p.writes {
+		diff.Keys = append(diff.Keys, []byte(key))
+	}
+
+	for key := range p.deletes {
+		if _, ok := p.writes[key]; !ok {
+			diff.Keys = append(diff.Keys, []byte(key))
+		}
+	}
+
+	sort.Slice(diff.Keys, func(i, j int) bool {
+		return bytes.Compare(diff.Keys[i], diff.Keys[j]) < 0
+	})
+
+	for _, key := range diff.Keys {
+		value, err := p.get(key)
+		if err != nil {
+			return fmt.Errorf("failed to load node %x: %w", key, err)
+		}
+
+		diff.Values = append(diff.Values, value)
+	}
+
+	// the diff is written first, so the previous version stays reachable without a batch
+	var batch pathBatch
+
+	if err := p.storeDiff(diff, &batch); err != nil {
+		return err
+	}
+
+	for key := range p.deletes {
+		if _, ok := p.writes[key]; !ok {
+			batch.delete([]byte(key))
+		}
+	}
+
+	for key, value := range p.writes {
+		batch.put([]byte(key), value)
+	}
+
+	return batch.write(p.storage)
+}
+
+// storeDiff adds the reverse diff to the batch and drops the one falling out of the history
+func (p *pathStore) storeDiff(diff *pathDiff, batch *pathBatch) error {
+	if p.history <= 0 {
+		return nil
+	}
+
+	head, err := p.head()
+	if err != nil {
+		return err
+	}
+
+	data, err := rlp.EncodeToBytes(diff)
+	if err != nil {
+		return fmt.Errorf("failed to encode reverse diff: %w", err)
+	}
+
+	head++
+
+	batch.put(p.diffKey(head), data)
+	batch.put(p.headKey(), binary.BigEndian.AppendUint64(nil, head))
+
+	if head > uint64(p.history) {
+		batch.delete(p.diffKey(head - uint64(p.history)))
+	}
+
+	return nil
+}
+
+// pathBatch collects the changes of a flush in order
+type pathBatch struct {
+	changes []pathChange
+}
+
+// pathChange is a write of a flush, or a delete if value is nil
+type pathChange struct {
+	key   []byte
+	value []byte
+}
+
+func (b *pathBatch) put(key, value []byte) {
+	// a nil value marks a delete
+	if value == nil {
+		value = []byte{}
+	}
+
+	b.changes = append(b.changes, pathChange{key: key, value: value})
+}
+
+func (b *pathBatch) delete(key []byte) {
+	b.changes = append(b.changes, pathChange{key: key})
+}
+
+// write applies the changes in a single write if the storage implements storage.Batcher,
+// or one by one in order otherwise
+func (b *pathBatch) write(db storage.Storage) error {
+	if batcher, ok := db.(storage.Batcher); ok {
+		var deletes, keys, values [][]byte
+
+		for _, change := range b.changes {
+			if change.value == nil {
+				deletes = append(deletes, change.key)
+			} else {
+				keys, values = append(keys, change.key), append(values, change.value)
+			}
+		}
+
+		if err := batcher.WriteBatch(deletes, keys, values); err != nil {
+			return fmt.Errorf("failed to store nodes: %w", err)
+		}
+
+		return nil
+	}
+
+	for _, change := range b.changes {
+		if change.value == nil {
+			if err := db.Delete(change.key); err != nil {
+				return fmt.Errorf("failed to delete %x: %w", change.key, err)
+			}
+
+			continue
+		}
+
+		if err := db.Put(change.key, change.value); err != nil {
+			return fmt.Errorf("failed to store %x: %w", change.key, err)
+		}
+	}
+
+	return nil
+}
+
+// childPaths collects the paths of the stored children of a node, including
+// those of the children embedded in it
+func childPaths(node nodes2.Node, paths [][]nibble.Nibble) [][]nibble.Nibble {
+	switch n := node.(type) {
+	case *nodes2.HashNode:
+		return append(paths, n.Path)
+	case *nodes2.ExtensionNode:
+		return childPaths(n.Node, paths)
+	case *nodes2.BranchNode:
+		for _, child := range n.Children {
+			paths = childPaths(child, paths)
+		}
+	}
+
+	return paths
+}
+
+// isStoredAt reports whether the committed subtree rooted at the given node holds a stored
+// node at the given path. Stored descendants are loaded from the staged writes or the storage
+func (p *pathStore) isStoredAt(node nodes2.Node, nodePath, path []nibble.Nibble) (bool, error) {
+	for {
+		if len(path) < len(nodePath) || !nibble.Equal(path[:len(nodePath)], nodePath) {
+			return false, nil
+		}
+
+		switch n := node.(type) {
+		case *nodes2.HashNode:
+			if len(path) == len(nodePath) {
+				return true, nil
+			}
+
+			key := p.nodeKey(nodePath)
+
+			data, ok := p.writes[string(key)]
+			if !ok {
+				var err error
+
+				if data, err = p.get(key); err != nil {
+					return false, err
+				}
+			}
+
+			resolved, err := decodeNodeData(data, nodePath)
+			if err != nil {
+				return false, fmt.Errorf("failed to decode node at path %x: %w", nodePath, err)
+			}
+
+			node = resolved
+		case *nodes2.ExtensionNode:
+			node, nodePath = n.Node, appendPath(nodePath, n.Path)
+		case *nodes2.BranchNode:
+			if len(path) == len(nodePath) {
+				return false, nil
+			}
+
+			node, nodePath = n.Children[path[len(nodePath)]], appendPath(nodePath, path[len(nodePath):len(nodePath)+1])
+		default:
+			return false, nil
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package trie
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/Aleksao998/Merkle-Patricia-Trie/storage/mpt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// storedReferences returns the number of stored nodes in the trie with the given root,
+// counting a node once for every path it is referenced from
+func storedReferences(t *testing.T, trie *Trie, root []byte) int {
+	t.Helper()
+
+	node, err := trie.DecodeNode(root)
+	require.NoError(t, err)
+
+	count := 1
+
+	for _, child := range nodeReferences(node, nil, nil) {
+		count += storedReferences(t, trie, child)
+	}
+
+	return count
+}
+
+// pathNodeKeys returns the number of nodes stored by path in the storage map
+func pathNodeKeys(data map[string][]byte) int {
+	count := 0
+
+	for key := range data {
+		if strings.HasPrefix(key, pathNodePrefix) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// TestPathSchemeMatchesHashScheme tests that the path scheme produces the same root hashes
+// as the hash scheme, and only keeps the latest version of the nodes in storage
+func TestPathSchemeMatchesHashScheme(t *testing.T) {
+	t.Parallel()
+
+	data := make(map[string][]byte)
+	pathDB := newMapStorage(data)
+	hashTrie := NewTrie(mpt.NewMPTMemoryStorage())
+	pathTrie := NewTrie(pathDB, WithPathScheme(4))
+
+	r := rand.New(rand.NewSource(1))
+	entries := make(map[string][]byte)
+
+	for round := 0; round < 30; round++ {
+		for i := 0; i < 40; i++ {
+			key := []byte(fmt.Sprintf("key-%d", r.Intn(300)))
+
+			// the first keys are never deleted, so the trie is never empty
+			if _, ok := entries[string(key)]; ok && r.Intn(3) == 0 && !bytes.HasPrefix(key, []byte("key-1")) {
+				require.NoError(t, hashTrie.Del(key))
+				require.NoError(t, pathTrie.Del(key))
+				delete(entries, string(key))
+
+				continue
+			}
+
+			// short values produce nodes embedded in their parent
+			value := bytes.Repeat([]byte{byte(round)}, r.Intn(40)+1)
+
+			require.NoError(t, hashTrie.Put(key, value))
+			require.NoError(t, pathTrie.Put(key, value))
+			entries[string(key)] = value
+		}
+
+		hashRoot, err := hashTrie.Commit()
+		require.NoError(t, err)
+
+		pathRoot, err := pathTrie.Commit()
+		require.NoError(t, err)
+		require.Equal(t, hashRoot, pathRoot, "round %d", round)
+
+		// stale nodes are deleted, every path holds a single node
+		require.Equal(t, storedReferences(t, hashTrie, hashRoot), pathNodeKeys(data), "round %d", round)
+
+		reloaded := NewTrie(pathDB, WithPathScheme(4))
+
+		for key, value := range entries {
+			got, err := reloaded.Get([]byte(key))
+			require.NoError(t, err)
+			require.Equal(t, value, got)
+		}
+
+		hash, err := reloaded.Hash()
+		require.NoError(t, err)
+		require.Equal(t, hashRoot, hash)
+	}
+}
+
+// TestPathSchemeHistory tests that the versions within the kept history can be opened
+// from the reverse diffs, and older versions are rejected
+func TestPathSchemeHistory(t *testing.T) {
+	t.Parallel()
+
+	const history = 3
+
+	db := newMapStorage(make(map[string][]byte))
+	trie := NewTrie(db, WithID("history"), WithPathScheme(history))
+
+	var roots [][]byte
+
+	for version := 0; version < 6; version++ {
+		for i := 0; i < 50; i++ {
+			key := []byte(fmt.Sprintf("key-%d", i*(version+1)%70))
+			require.NoError(t, trie.Put(key, []byte(fmt.Sprintf("value-%d-%d", version, i))))
+		}
+
+		root, err := trie.Commit()
+		require.NoError(t, err)
+
+		roots = append(roots, root)
+	}
+
+	// the latest version and the previous ones within the history
+	for version := len(roots) - 1 - history; version < len(roots); version++ {
+		old, err := NewTrieAt(roots[version], db, WithID("history"), WithPathScheme(history))
+		require.NoError(t, err)
+
+		hash, err := old.Hash()
+		require.NoError(t, err)
+		assert.Equal(t, roots[version], hash)
+
+		expected := NewTrie(mpt.NewMPTMemoryStorage())
+
+		for v := 0; v <= version; v++ {
+			for i := 0; i < 50; i++ {
+				key := []byte(fmt.Sprintf("key-%d", i*(v+1)%70))
+				require.NoError(t, expected.Put(key, []byte(fmt.Sprintf("value-%d-%d", v, i))))
+			}
+		}
+
+		for it := expected.NewIterator(); it.Next(); {
+			value, err := old.Get(it.Key())
+			require.NoError(t, err)
+			assert.Equal(t, it.Value(), value)
+		}
+
+		// a historical version is read-only
+		require.NoError(t, old.Put([]byte("key-0"), []byte("updated")))
+
+		_, err = old.Commit()
+		assert.ErrorIs(t, err, errReadOnlyTrie)
+	}
+
+	// versions beyond the history are gone
+	_, err := NewTrieAt(roots[len(roots)-2-history], db, WithID("history"), WithPathScheme(history))
+	assert.ErrorIs(t, err, errRootNotFound)
+
+	// the latest version is unaffected by the historical tries
+	value, err := NewTrie(db, WithID("history"), WithPathScheme(history)).Get([]byte("key-0"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("value-5-35"), value)
+}
+
+// TestPathSchemeBatchedFlush tests that each commit of the path scheme writes its nodes,
+// deletions and reverse diff in a single batch, so a failed write leaves the storage untouched
+func TestPathSchemeBatchedFlush(t *testing.T) {
+	t.Parallel()
+
+	errWrite := errors.New("write failed")
+	db := &batchStorage{recordingStorage: newRecordingStorage()}
+	trie := NewTrie(db, WithID("batched"), WithPathScheme(2))
+
+	var root []byte
+
+	for version := 0; version < 3; version++ {
+		for i := 0; i < 50; i++ {
+			key := []byte(fmt.Sprintf("key-%d", i*(version+1)%70))
+			require.NoError(t, trie.Put(key, []byte(fmt.Sprintf("value-%d-%d", version, i))))
+		}
+
+		var err error
+
+		root, err = trie.Commit()
+		require.NoError(t, err)
+		require.Equal(t, version+1, db.batches)
+	}
+
+	// snapshot returns all the key-value pairs of the storage
+	snapshot := func() map[string][]byte {
+		pairs := make(map[string][]byte)
+
+		require.NoError(t, db.Iterate(nil, func(key, value []byte) bool {
+			pairs[string(key)] = value
+
+			return true
+		}))
+
+		return pairs
+	}
+
+	before := snapshot()
+
+	for i := 0; i < 70; i += 2 {
+		require.NoError(t, trie.Del([]byte(fmt.Sprintf("key-%d", i))))
+	}
+
+	db.failWrites(errWrite)
+
+	_, err := trie.Commit()
+	require.ErrorIs(t, err, errWrite)
+	assert.Equal(t, before, snapshot())
+
+	db.failWrites(nil)
+
+	latest, err := NewTrie(db, WithID("batched"), WithPathScheme(2)).Hash()
+	require.NoError(t, err)
+	assert.Equal(t, root, latest)
+}
+
+// TestPathSchemeProofsAndIteration tests that proofs and iteration resolve committed nodes by path
+func TestPathSchemeProofsAndIteration(t *testing.T) {
+	t.Parallel()
+
+	db := newMapStorage(make(map[string][]byte))
+	trie := NewTrie(db, WithPathScheme(1))
+
+	for _, key := range iteratorTestKeys() {
+		require.NoError(t, trie.Put(key, bytes.Repeat(key, 10)))
+	}
+
+	root, err := trie.Commit()
+	require.NoError(t, err)
+
+	reloaded := NewTrie(db, WithPathScheme(1))
+
+	keys, values := collect(t, reloaded.NewIterator())
+	require.Len(t, keys, len(iteratorTestKeys()))
+
+	for _, key := range keys {
+		assert.Equal(t, bytes.Repeat(key, 10), values[string(key)])
+
+		proof, err := NewTrie(db, WithPathScheme(1)).Proof(key)
+		require.NoError(t, err)
+
+		value, err := VerifyProof(root, key, proof)
+		require.NoError(t, err)
+		assert.Equal(t, bytes.Repeat(key, 10), value)
+	}
+}
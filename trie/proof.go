@@ -1,46 +1,68 @@
 package trie
 
 import (
+	"fmt"
+
 	"github.com/Aleksao998/Merkle-Patricia-Trie/storage"
 	"github.com/Aleksao998/Merkle-Patricia-Trie/storage/mpt"
+	"github.com/Aleksao998/Merkle-Patricia-Trie/trie/crypto"
 	"github.com/Aleksao998/Merkle-Patricia-Trie/trie/nibble"
 	nodes2 "github.com/Aleksao998/Merkle-Patricia-Trie/trie/nodes"
-	"github.com/ethereum/go-ethereum/rlp"
 )
 
 func (t *Trie) GenerateProof(root nodes2.Node, key []byte) (storage.Storage, error) {
+	db := mpt.NewMPTMemoryStorage()
+	_, err := t.proveInto(db, root, key)
+
+	return db, err
+}
+
+// proveInto stores every node on the path to the key in the given proof storage.
+// If the key is not in the trie, ErrKeyNotFound is returned along with the kind of divergence
+func (t *Trie) proveInto(db storage.Storage, root nodes2.Node, key []byte) (AbsenceKind, error) {
 	currentNode := root
 	nibblePath := nibble.FromBytes(key)
-	db := mpt.NewMPTMemoryStorage()
+	isRoot := true
+
+	// an empty trie has no nodes to prove with
+	if root == nil {
+		return AbsenceEmptyTrie, ErrKeyNotFound
+	}
 
 	for {
 		switch node := currentNode.(type) {
 		case nil:
-			// If node is nil, then the path does not exist in the trie
-			t.storeNode(db, currentNode)
-
-			return db, errKeyNotFound
+			// If node is nil, then the path ends in an empty branch slot
+			return AbsenceEmptySlot, ErrKeyNotFound
 
 		case *nodes2.LeafNode:
-			t.storeNode(db, node)
+			if err := t.storeNode(db, node, isRoot); err != nil {
+				return AbsenceNone, err
+			}
+
+			isRoot = false
 
 			if nibble.Equal(node.Path, nibblePath) {
 				// Key found in trie
-				return db, nil
+				return AbsenceNone, nil
 			}
 			// Path mismatch
-			return db, errKeyNotFound
+			return AbsenceLeafMismatch, ErrKeyNotFound
 
 		case *nodes2.BranchNode:
-			t.storeNode(db, node)
+			if err := t.storeNode(db, node, isRoot); err != nil {
+				return AbsenceNone, err
+			}
+
+			isRoot = false
 
 			if len(nibblePath) == 0 {
 				_, found := node.GetValue()
 				if found {
-					return db, nil
+					return AbsenceNone, nil
 				}
 
-				return db, errKeyNotFound
+				return AbsenceMissingValue, ErrKeyNotFound
 			}
 			// Move to the next node in the branch
 			currentNode = node.Children[nibblePath[0]]
@@ -49,11 +71,15 @@ func (t *Trie) GenerateProof(root nodes2.Node, key []byte) (storage.Storage, err
 			continue
 
 		case *nodes2.ExtensionNode:
-			t.storeNode(db, node)
+			if err := t.storeNode(db, node, isRoot); err != nil {
+				return AbsenceNone, err
+			}
+
+			isRoot = false
 
 			matchLen := nibble.CommonPrefixLength(node.Path, nibblePath)
 			if matchLen < len(node.Path) {
-				return db, errKeyNotFound
+				return AbsenceExtensionMismatch, ErrKeyNotFound
 			}
 
 			nibblePath = nibblePath[matchLen:]
@@ -61,31 +87,31 @@ func (t *Trie) GenerateProof(root nodes2.Node, key []byte) (storage.Storage, err
 
 			continue
 		case *nodes2.HashNode:
-			actualNode, err := t.DecodeNode(node.Hash)
+			actualNode, err := t.resolve(node)
 			if err != nil {
-				return db, err
+				return AbsenceNone, err
 			}
 
 			currentNode = actualNode
 
-			t.storeNode(db, currentNode)
-
 			continue
 		default:
-			panic("Unexpected node type encountered while traversing the trie")
+			return AbsenceNone, fmt.Errorf("%w: %T", errUnexpectedNode, node)
 		}
 	}
-
-	return db, errKeyNotFound
 }
 
-func (t *Trie) storeNode(db storage.Storage, node nodes2.Node) {
-	rawNode := t.NodeRaw(node, false)
-
-	encoded, err := rlp.EncodeToBytes(rawNode)
+// storeNode stores the node in the proof storage under its hash. Nodes shorter than
+// 32 bytes are embedded in their parent, so they are only stored if they are the root
+func (t *Trie) storeNode(db storage.Storage, node nodes2.Node, isRoot bool) error {
+	encoded, err := t.encodeNode(node)
 	if err != nil {
-		panic(err)
+		return err
+	}
+
+	if len(encoded) < 32 && !isRoot {
+		return nil
 	}
 
-	db.Put(t.NodeHash(node), encoded)
+	return db.Put(crypto.Keccak256(encoded), encoded)
 }
@@ -0,0 +1,171 @@
+package trie
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/Aleksao998/Merkle-Patricia-Trie/storage"
+	"github.com/Aleksao998/Merkle-Patricia-Trie/storage/mpt"
+	"github.com/Aleksao998/Merkle-Patricia-Trie/trie/crypto"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+var errMalformedProof = errors.New("malformed proof encoding")
+
+// Proof is the ordered list of RLP-encoded nodes on the path from the root to a key
+type Proof struct {
+	Nodes [][]byte
+}
+
+// ProofList returns the Merkle-proof of the key as an ordered list of nodes.
+// Like Proof, it returns ErrKeyNotFound together with the proof of a missing key
+func (t *Trie) ProofList(key []byte) (*Proof, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.getRootHash(); err != nil {
+		return nil, err
+	}
+
+	recorder := &proofRecorder{}
+	_, err := t.proveInto(recorder, t.root, key)
+
+	return &Proof{Nodes: recorder.nodes}, err
+}
+
+// Storage returns the proof nodes keyed by their hash, as expected by the proof verifiers
+func (p *Proof) Storage() storage.Storage {
+	db := mpt.NewMPTMemoryStorage()
+
+	for _, node := range p.Nodes {
+		// the in-memory storage never fails
+		_ = db.Put(crypto.Keccak256(node), node)
+	}
+
+	return db
+}
+
+// EncodeRLP encodes the proof as an RLP list of nodes
+func (p *Proof) EncodeRLP() ([]byte, error) {
+	return rlp.EncodeToBytes(p.Nodes)
+}
+
+// DecodeProofRLP decodes a proof encoded as an RLP list of nodes
+func DecodeProofRLP(data []byte) (*Proof, error) {
+	var nodes [][]byte
+	if err := rlp.DecodeBytes(data, &nodes); err != nil {
+		return nil, fmt.Errorf("%w: %w", errMalformedProof, err)
+	}
+
+	return &Proof{Nodes: nodes}, nil
+}
+
+// MarshalJSON encodes the proof as a JSON array of hex strings,
+// the format of the accountProof field of eth_getProof
+func (p *Proof) MarshalJSON() ([]byte, error) {
+	nodes := make([]hexutil.Bytes, 0, len(p.Nodes))
+
+	for _, node := range p.Nodes {
+		nodes = append(nodes, node)
+	}
+
+	return json.Marshal(nodes)
+}
+
+// UnmarshalJSON decodes a proof from a JSON array of hex strings
+func (p *Proof) UnmarshalJSON(data []byte) error {
+	var nodes []hexutil.Bytes
+	if err := json.Unmarshal(data, &nodes); err != nil {
+		return fmt.Errorf("%w: %w", errMalformedProof, err)
+	}
+
+	p.Nodes = make([][]byte, 0, len(nodes))
+
+	for _, node := range nodes {
+		p.Nodes = append(p.Nodes, node)
+	}
+
+	return nil
+}
+
+// MarshalBinary encodes the proof in a compact binary format:
+// the number of nodes followed by every node prefixed with its length, all as uvarints
+func (p *Proof) MarshalBinary() ([]byte, error) {
+	size := binary.MaxVarintLen64
+
+	for _, node := range p.Nodes {
+		size += binary.MaxVarintLen64 + len(node)
+	}
+
+	buf := make([]byte, 0, size)
+	buf = binary.AppendUvarint(buf, uint64(len(p.Nodes)))
+
+	for _, node := range p.Nodes {
+		buf = binary.AppendUvarint(buf, uint64(len(node)))
+		buf = append(buf, node...)
+	}
+
+	return buf, nil
+}
+
+// UnmarshalBinary decodes a proof from the compact binary format
+func (p *Proof) UnmarshalBinary(data []byte) error {
+	count, n := binary.Uvarint(data)
+	if n <= 0 {
+		return fmt.Errorf("%w: invalid node count", errMalformedProof)
+	}
+
+	data = data[n:]
+
+	// every node takes at least one byte, which bounds the allocation
+	if count > uint64(len(data)) {
+		return fmt.Errorf("%w: %d nodes in %d bytes", errMalformedProof, count, len(data))
+	}
+
+	nodes := make([][]byte, 0, count)
+
+	for i := uint64(0); i < count; i++ {
+		length, n := binary.Uvarint(data)
+		if n <= 0 || length > uint64(len(data)-n) {
+			return fmt.Errorf("%w: invalid length of node %d", errMalformedProof, i)
+		}
+
+		data = data[n:]
+		nodes = append(nodes, append([]byte{}, data[:length]...))
+		data = data[length:]
+	}
+
+	if len(data) != 0 {
+		return fmt.Errorf("%w: %d trailing bytes", errMalformedProof, len(data))
+	}
+
+	p.Nodes = nodes
+
+	return nil
+}
+
+// proofRecorder is a write-only storage that keeps proof nodes in the order they are stored
+type proofRecorder struct {
+	nodes [][]byte
+}
+
+func (r *proofRecorder) Has(key []byte) (bool, error) {
+	return false, nil
+}
+
+func (r *proofRecorder) Get(key []byte) ([]byte, error) {
+	return nil, ErrKeyNotFound
+}
+
+func (r *proofRecorder) Put(key []byte, value []byte) error {
+	r.nodes = append(r.nodes, value)
+
+	return nil
+}
+
+func (r *proofRecorder) Delete(key []byte) error {
+	return nil
+}
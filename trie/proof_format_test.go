@@ -0,0 +1,82 @@
+package trie
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestProofListFormats tests that an ordered proof survives every serialization format
+// and still verifies against the root hash
+func TestProofListFormats(t *testing.T) {
+	t.Parallel()
+
+	trie, entries := newProofTestTrie(t)
+
+	root, err := trie.Hash()
+	require.NoError(t, err)
+
+	proof, err := trie.ProofList([]byte("dogglesworth"))
+	require.NoError(t, err)
+	require.NotEmpty(t, proof.Nodes)
+
+	// the first node is the root node
+	rootNode, err := trie.Proof([]byte("dogglesworth"))
+	require.NoError(t, err)
+
+	expectedRoot, err := rootNode.Get(root)
+	require.NoError(t, err)
+	assert.Equal(t, expectedRoot, proof.Nodes[0])
+
+	encodedRLP, err := proof.EncodeRLP()
+	require.NoError(t, err)
+
+	fromRLP, err := DecodeProofRLP(encodedRLP)
+	require.NoError(t, err)
+
+	encodedJSON, err := json.Marshal(proof)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(encodedJSON), `["0x`))
+
+	fromJSON := &Proof{}
+	require.NoError(t, json.Unmarshal(encodedJSON, fromJSON))
+
+	encodedBinary, err := proof.MarshalBinary()
+	require.NoError(t, err)
+
+	fromBinary := &Proof{}
+	require.NoError(t, fromBinary.UnmarshalBinary(encodedBinary))
+
+	for _, decoded := range []*Proof{fromRLP, fromJSON, fromBinary} {
+		assert.Equal(t, proof.Nodes, decoded.Nodes)
+
+		value, err := VerifyProof(root, []byte("dogglesworth"), decoded.Storage())
+		require.NoError(t, err)
+		assert.Equal(t, entries["dogglesworth"], value)
+	}
+}
+
+// TestProofListMalformed tests that corrupted encodings are rejected
+func TestProofListMalformed(t *testing.T) {
+	t.Parallel()
+
+	trie, _ := newProofTestTrie(t)
+
+	proof, err := trie.ProofList([]byte("dog"))
+	require.NoError(t, err)
+
+	encodedBinary, err := proof.MarshalBinary()
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, (&Proof{}).UnmarshalBinary(encodedBinary[:len(encodedBinary)-1]), errMalformedProof)
+	assert.ErrorIs(t, (&Proof{}).UnmarshalBinary(append(encodedBinary, 0)), errMalformedProof)
+	assert.ErrorIs(t, (&Proof{}).UnmarshalBinary(nil), errMalformedProof)
+
+	_, err = DecodeProofRLP([]byte{0xc5, 0x01})
+	assert.ErrorIs(t, err, errMalformedProof)
+
+	assert.ErrorIs(t, json.Unmarshal([]byte(`["0xzz"]`), &Proof{}), errMalformedProof)
+}
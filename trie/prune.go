@@ -0,0 +1,245 @@
+package trie
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/Aleksao998/Merkle-Patricia-Trie/storage"
+	"github.com/Aleksao998/Merkle-Patricia-Trie/trie/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	// pruneStateKey is the storage key of the state of an interrupted prune
+	pruneStateKey = "pruneState"
+
+	// pruneReportInterval is the number of nodes marked or keys swept between progress reports
+	pruneReportInterval = 10000
+)
+
+var (
+	errNotIterable        = errors.New("storage does not support iteration")
+	errNoPruneRoots       = errors.New("no roots to keep")
+	errPruneRootsMismatch = errors.New("an interrupted prune with different roots must be resumed first")
+)
+
+// PruneProgress reports the progress of a prune
+type PruneProgress struct {
+	Marked    int    // nodes reachable from the kept roots
+	Scanned   int    // keys visited by the sweep
+	Deleted   int    // nodes deleted by the sweep
+	Reclaimed uint64 // size of the deleted keys and values, in bytes
+}
+
+// pruneState is persisted during a prune, so an interrupted prune can be resumed
+type pruneState struct {
+	Roots [][]byte
+	Next  []byte // key the sweep resumes from
+}
+
+// Prune deletes every trie node that is not reachable from the given roots. It marks the nodes
+// of the kept roots with DecodeNode, then sweeps all node keys of the storage, which has to be
+// storage.Iterable. Keys that are not nodes, like root pointers and preimages, are left untouched,
+// as are the nodes of the path scheme, which deletes stale nodes on commit. The optional leaves
+// function returns the roots referenced by the leaf values, whose tries are kept as well.
+// The prune is safe to interrupt: calling Prune again resumes it, and nil roots resume it with the
+// roots it was started with. The optional report function is called as the prune progresses
+func Prune(
+	db storage.Storage,
+	roots [][]byte,
+	leaves LeafReferences,
+	report func(PruneProgress),
+) (PruneProgress, error) {
+	var progress PruneProgress
+
+	iterable, ok := db.(storage.Iterable)
+	if !ok {
+		return progress, errNotIterable
+	}
+
+	state, err := loadPruneState(db)
+	if err != nil {
+		return progress, err
+	}
+
+	switch {
+	case state != nil && roots != nil && !equalRoots(state.Roots, roots):
+		return progress, errPruneRootsMismatch
+	case state == nil && len(roots) == 0:
+		return progress, errNoPruneRoots
+	case state == nil:
+		for _, root := range roots {
+			// an empty trie has no nodes to keep
+			if isEmptyRoot(root) {
+				continue
+			}
+
+			found, err := db.Has(root)
+			if err != nil {
+				return progress, fmt.Errorf("failed to load root node %x: %w", root, err)
+			}
+
+			if !found {
+				return progress, fmt.Errorf("%w: %x", errRootNotFound, root)
+			}
+		}
+
+		state = &pruneState{Roots: roots}
+
+		// the roots are persisted before anything is deleted
+		if err := storePruneState(db, state); err != nil {
+			return progress, err
+		}
+	}
+
+	if report == nil {
+		report = func(PruneProgress) {}
+	}
+
+	marked, err := markNodes(NewTrie(db), state.Roots, leaves, &progress, report)
+	if err != nil {
+		return progress, err
+	}
+
+	var sweepErr error
+
+	err = iterable.Iterate(state.Next, func(key, value []byte) bool {
+		if progress.Scanned%pruneReportInterval == 0 && progress.Scanned > 0 {
+			// the current key is not swept yet, so the sweep resumes from it
+			state.Next = key
+			if sweepErr = storePruneState(db, state); sweepErr != nil {
+				return false
+			}
+
+			report(progress)
+		}
+
+		progress.Scanned++
+
+		if _, ok := marked[string(key)]; ok || !isNodeEntry(key, value) {
+			return true
+		}
+
+		if sweepErr = db.Delete(key); sweepErr != nil {
+			sweepErr = fmt.Errorf("failed to delete node %x: %w", key, sweepErr)
+
+			return false
+		}
+
+		progress.Deleted++
+		progress.Reclaimed += uint64(len(key) + len(value))
+
+		return true
+	})
+	if err != nil {
+		return progress, fmt.Errorf("failed to sweep storage: %w", err)
+	}
+
+	if sweepErr != nil {
+		return progress, sweepErr
+	}
+
+	if err := db.Delete([]byte(pruneStateKey)); err != nil {
+		return progress, fmt.Errorf("failed to clear prune state: %w", err)
+	}
+
+	report(progress)
+
+	return progress, nil
+}
+
+// markNodes returns the hashes of all nodes reachable from the roots, following the roots
+// referenced by the leaf values if leaves is not nil
+func markNodes(
+	tr *Trie,
+	roots [][]byte,
+	leaves LeafReferences,
+	progress *PruneProgress,
+	report func(PruneProgress),
+) (map[string]struct{}, error) {
+	marked := make(map[string]struct{})
+	pending := append([][]byte{}, roots...)
+
+	for len(pending) > 0 {
+		hash := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		if _, ok := marked[string(hash)]; ok || isEmptyRoot(hash) {
+			continue
+		}
+
+		node, err := tr.DecodeNode(hash)
+		if err != nil {
+			return nil, err
+		}
+
+		marked[string(hash)] = struct{}{}
+		pending = nodeReferences(node, pending, leaves)
+
+		progress.Marked++
+		if progress.Marked%pruneReportInterval == 0 {
+			report(*progress)
+		}
+	}
+
+	return marked, nil
+}
+
+// isNodeEntry reports whether the key-value pair is a trie node stored under its hash
+func isNodeEntry(key, value []byte) bool {
+	return len(key) == 32 && bytes.Equal(crypto.Keccak256(value), key)
+}
+
+// equalRoots reports whether both lists hold the same roots in the same order
+func equalRoots(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// loadPruneState reads the state of an interrupted prune, or nil if there is none
+func loadPruneState(db storage.Storage) (*pruneState, error) {
+	found, err := db.Has([]byte(pruneStateKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load prune state: %w", err)
+	}
+
+	if !found {
+		return nil, nil
+	}
+
+	data, err := db.Get([]byte(pruneStateKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load prune state: %w", err)
+	}
+
+	state := new(pruneState)
+	if err := rlp.DecodeBytes(data, state); err != nil {
+		return nil, fmt.Errorf("failed to decode prune state: %w", err)
+	}
+
+	return state, nil
+}
+
+// storePruneState persists the state of a running prune
+func storePruneState(db storage.Storage, state *pruneState) error {
+	data, err := rlp.EncodeToBytes(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode prune state: %w", err)
+	}
+
+	if err := db.Put([]byte(pruneStateKey), data); err != nil {
+		return fmt.Errorf("failed to store prune state: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,209 @@
+package trie
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Aleksao998/Merkle-Patricia-Trie/storage/mpt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// interruptedStorage is a memory storage whose deletions fail once the given number is reached
+type interruptedStorage struct {
+	*mpt.MPTMemoryStorage
+	deletions int
+}
+
+func (s *interruptedStorage) Delete(key []byte) error {
+	if s.deletions == 0 {
+		return errors.New("interrupted")
+	}
+
+	s.deletions--
+
+	return s.MPTMemoryStorage.Delete(key)
+}
+
+// countNodes returns the number of trie nodes in the storage
+func countNodes(t *testing.T, db *mpt.MPTMemoryStorage) int {
+	t.Helper()
+
+	count := 0
+
+	require.NoError(t, db.Iterate(nil, func(key, value []byte) bool {
+		if isNodeEntry(key, value) {
+			count++
+		}
+
+		return true
+	}))
+
+	return count
+}
+
+// newPruneTestStorage commits several versions of a trie and returns their roots
+func newPruneTestStorage(t *testing.T) (*mpt.MPTMemoryStorage, [][]byte) {
+	t.Helper()
+
+	db := mpt.NewMPTMemoryStorage()
+	trie := NewTrie(db)
+
+	var roots [][]byte
+
+	for version := 0; version < 4; version++ {
+		for i := 0; i < 100; i++ {
+			key := []byte(fmt.Sprintf("key-%d", i*(version+1)))
+			require.NoError(t, trie.Put(key, []byte(fmt.Sprintf("value of version %d and key %d", version, i))))
+		}
+
+		root, err := trie.Commit()
+		require.NoError(t, err)
+
+		roots = append(roots, root)
+	}
+
+	require.NoError(t, db.Put(preimageKey([]byte("hashed")), []byte("key")))
+
+	return db, roots
+}
+
+// TestPrune tests that pruning keeps exactly the nodes reachable from the kept roots
+func TestPrune(t *testing.T) {
+	t.Parallel()
+
+	db, roots := newPruneTestStorage(t)
+	before := countNodes(t, db)
+	reports := 0
+
+	progress, err := Prune(db, roots[2:], nil, func(PruneProgress) { reports++ })
+	require.NoError(t, err)
+
+	reachable := make(map[string]struct{})
+	for _, root := range roots[2:] {
+		reachableNodes(t, NewTrie(db), root, reachable)
+	}
+
+	assert.Equal(t, len(reachable), countNodes(t, db))
+	assert.Equal(t, len(reachable), progress.Marked)
+	assert.Equal(t, before-len(reachable), progress.Deleted)
+	assert.Greater(t, progress.Reclaimed, uint64(32*progress.Deleted))
+	assert.Positive(t, reports)
+
+	for _, root := range roots[:2] {
+		_, err := NewTrieAt(root, db)
+		require.ErrorIs(t, err, errRootNotFound)
+	}
+
+	for _, root := range roots[2:] {
+		trie, err := NewTrieAt(root, db)
+		require.NoError(t, err)
+
+		it := trie.NewIterator()
+		for it.Next() {
+		}
+
+		require.NoError(t, it.Err())
+	}
+
+	// the root pointer and the keys that are not nodes are kept
+	value, err := NewTrie(db).Get([]byte("key-4"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("value of version 3 and key 1"), value)
+
+	found, err := db.Has(preimageKey([]byte("hashed")))
+	require.NoError(t, err)
+	assert.True(t, found)
+
+	_, err = Prune(db, nil, nil, nil)
+	require.ErrorIs(t, err, errNoPruneRoots)
+
+	_, err = Prune(db, [][]byte{roots[0]}, nil, nil)
+	require.ErrorIs(t, err, errRootNotFound)
+}
+
+// TestPruneResume tests that an interrupted prune is resumed with its original roots
+func TestPruneResume(t *testing.T) {
+	t.Parallel()
+
+	memory, roots := newPruneTestStorage(t)
+	db := &interruptedStorage{MPTMemoryStorage: memory, deletions: 10}
+
+	_, err := Prune(db, roots[3:], nil, nil)
+	require.Error(t, err)
+
+	_, err = Prune(db, roots[2:], nil, nil)
+	require.ErrorIs(t, err, errPruneRootsMismatch)
+
+	db.deletions = -1
+
+	_, err = Prune(db, nil, nil, nil)
+	require.NoError(t, err)
+
+	reachable := make(map[string]struct{})
+	reachableNodes(t, NewTrie(db), roots[3], reachable)
+	assert.Equal(t, len(reachable), countNodes(t, memory))
+
+	found, err := db.Has([]byte(pruneStateKey))
+	require.NoError(t, err)
+	assert.False(t, found)
+}
+
+// TestHeadRoots tests that the heads of the default, registered and unregistered named tries
+// are kept, along with the recent roots of the tries with a root history
+func TestHeadRoots(t *testing.T) {
+	t.Parallel()
+
+	db := mpt.NewMPTMemoryStorage()
+
+	registered, err := NewRegistry(db).Open("registered")
+	require.NoError(t, err)
+
+	tries := []*Trie{
+		NewTrie(db, WithRootHistory(2)),
+		registered,
+		NewTrie(db, WithID("unregistered")),
+	}
+
+	versions := make([][][]byte, len(tries))
+
+	for version := 0; version < 3; version++ {
+		for i, trie := range tries {
+			key := []byte(fmt.Sprintf("key-%d", i))
+			require.NoError(t, trie.Put(key, []byte(fmt.Sprintf("value of version %d", version))))
+
+			root, err := trie.Commit()
+			require.NoError(t, err)
+
+			versions[i] = append(versions[i], root)
+		}
+	}
+
+	heads, err := HeadRoots(db, 0)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, [][]byte{versions[0][2], versions[1][2], versions[2][2]}, heads)
+
+	heads, err = HeadRoots(db, 5)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, [][]byte{versions[0][2], versions[0][1], versions[1][2], versions[2][2]}, heads)
+
+	_, err = Prune(db, heads, nil, nil)
+	require.NoError(t, err)
+
+	for i, id := range []string{"", "registered", "unregistered"} {
+		value, err := NewTrie(db, WithID(id)).Get([]byte(fmt.Sprintf("key-%d", i)))
+		require.NoError(t, err)
+		assert.Equal(t, []byte("value of version 2"), value)
+	}
+
+	previous, err := NewTrieAt(versions[0][1], db)
+	require.NoError(t, err)
+
+	value, err := previous.Get([]byte("key-0"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("value of version 1"), value)
+
+	_, err = NewTrieAt(versions[0][0], db)
+	require.ErrorIs(t, err, errRootNotFound)
+}
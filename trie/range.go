@@ -0,0 +1,125 @@
+package trie
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/Aleksao998/Merkle-Patricia-Trie/trie/nibble"
+	nodes2 "github.com/Aleksao998/Merkle-Patricia-Trie/trie/nodes"
+)
+
+// KeyValue is a single key/value pair returned by range queries
+type KeyValue struct {
+	Key   []byte
+	Value []byte
+}
+
+// ScanPrefix returns all key/value pairs whose key starts with the given prefix, in key order.
+// The traversal descends straight to the subtree holding the prefix instead of walking the whole trie
+func (t *Trie) ScanPrefix(prefix []byte) ([]KeyValue, error) {
+	t.mu.Lock()
+
+	if err := t.getRootHash(); err != nil {
+		t.mu.Unlock()
+
+		return nil, err
+	}
+
+	node, path, err := t.prefixNode(t.root, nibble.FromBytes(prefix))
+
+	t.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	it := &Iterator{trie: t, root: node}
+	it.push(node, path)
+
+	var result []KeyValue
+
+	for it.Next() {
+		result = append(result, KeyValue{Key: it.Key(), Value: it.Value()})
+	}
+
+	return result, it.Err()
+}
+
+// Range returns the key/value pairs with start <= key < end, in key order.
+// A nil end means the range is unbounded, and a limit lower than 1 means there is no limit
+func (t *Trie) Range(start, end []byte, limit int) ([]KeyValue, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.rangeOf(start, end, limit)
+}
+
+// rangeOf returns the key/value pairs of the range like Range, the trie lock has to be held
+func (t *Trie) rangeOf(start, end []byte, limit int) ([]KeyValue, error) {
+	it := t.newIterator()
+	it.seek(start)
+
+	var result []KeyValue
+
+	for (limit < 1 || len(result) < limit) && it.next() {
+		if end != nil && bytes.Compare(it.Key(), end) >= 0 {
+			break
+		}
+
+		result = append(result, KeyValue{Key: it.Key(), Value: it.Value()})
+	}
+
+	return result, it.Err()
+}
+
+// prefixNode follows the nibble prefix from the given node and returns the node whose subtree
+// holds exactly the keys starting with the prefix, together with the nibble path leading to it.
+// A nil node is returned if no key starts with the prefix
+func (t *Trie) prefixNode(node nodes2.Node, prefix []nibble.Nibble) (nodes2.Node, []nibble.Nibble, error) {
+	var path []nibble.Nibble
+
+	for {
+		switch n := node.(type) {
+		case nil:
+			return nil, nil, nil
+		case *nodes2.HashNode:
+			actualNode, err := t.resolve(n)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			node = actualNode
+		case *nodes2.LeafNode:
+			if nibble.CommonPrefixLength(n.Path, prefix) < len(prefix) {
+				return nil, nil, nil
+			}
+
+			return n, path, nil
+		case *nodes2.ExtensionNode:
+			commonLength := nibble.CommonPrefixLength(n.Path, prefix)
+
+			// the prefix ends inside the extension, the whole subtree matches
+			if commonLength == len(prefix) {
+				return n, path, nil
+			}
+
+			if commonLength < len(n.Path) {
+				return nil, nil, nil
+			}
+
+			path = appendPath(path, n.Path)
+			prefix = prefix[commonLength:]
+			node = n.Node
+		case *nodes2.BranchNode:
+			if len(prefix) == 0 {
+				return n, path, nil
+			}
+
+			path = appendPath(path, prefix[:1])
+			node = n.Children[prefix[0]]
+			prefix = prefix[1:]
+		default:
+			return nil, nil, fmt.Errorf("%w: %T", errUnexpectedNode, n)
+		}
+	}
+}
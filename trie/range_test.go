@@ -0,0 +1,104 @@
+package trie
+
+import (
+	"testing"
+
+	"github.com/Aleksao998/Merkle-Patricia-Trie/storage/mpt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newNamespacedTrie returns a committed trie holding keys from several namespaces
+func newNamespacedTrie(t *testing.T) *Trie {
+	t.Helper()
+
+	trie := NewTrie(mpt.NewMPTMemoryStorage())
+
+	keys := []string{
+		"user/alice", "user/bob", "user/carol", "user",
+		"order/1", "order/2", "order/10",
+		"users", "zeta",
+	}
+
+	for _, key := range keys {
+		require.NoError(t, trie.Put([]byte(key), []byte("v-"+key)))
+	}
+
+	_, err := trie.Commit()
+	require.NoError(t, err)
+
+	return trie
+}
+
+// keysOf returns the keys of the given pairs as strings
+func keysOf(pairs []KeyValue) []string {
+	keys := make([]string, 0, len(pairs))
+
+	for _, pair := range pairs {
+		keys = append(keys, string(pair.Key))
+	}
+
+	return keys
+}
+
+// TestScanPrefix tests that a prefix scan returns exactly the keys sharing the prefix in key order
+func TestScanPrefix(t *testing.T) {
+	t.Parallel()
+
+	trie := newNamespacedTrie(t)
+
+	testCases := []struct {
+		prefix   string
+		expected []string
+	}{
+		{"user/", []string{"user/alice", "user/bob", "user/carol"}},
+		{"user", []string{"user", "user/alice", "user/bob", "user/carol", "users"}},
+		{"order/1", []string{"order/1", "order/10"}},
+		{"zet", []string{"zeta"}},
+		{"zetas", []string{}},
+		{"missing", []string{}},
+	}
+
+	for _, tt := range testCases {
+		result, err := trie.ScanPrefix([]byte(tt.prefix))
+		require.NoError(t, err)
+
+		assert.Equal(t, tt.expected, keysOf(result), "prefix %q", tt.prefix)
+	}
+
+	result, err := trie.ScanPrefix([]byte("user/bob"))
+	require.NoError(t, err)
+	require.Len(t, result, 1)
+	assert.Equal(t, []byte("v-user/bob"), result[0].Value)
+
+	all, err := trie.ScanPrefix(nil)
+	require.NoError(t, err)
+	assert.Len(t, all, 9)
+}
+
+// TestRange tests bounded range queries with and without a limit
+func TestRange(t *testing.T) {
+	t.Parallel()
+
+	trie := newNamespacedTrie(t)
+
+	testCases := []struct {
+		name     string
+		start    string
+		end      []byte
+		limit    int
+		expected []string
+	}{
+		{"half open range", "order/", []byte("order/2"), 0, []string{"order/1", "order/10"}},
+		{"unbounded end", "user/c", nil, 0, []string{"user/carol", "users", "zeta"}},
+		{"limit", "", nil, 2, []string{"order/1", "order/10"}},
+		{"empty range", "user/d", []byte("user/e"), 0, []string{}},
+	}
+
+	for _, tt := range testCases {
+		result, err := trie.Range([]byte(tt.start), tt.end, tt.limit)
+		require.NoError(t, err)
+
+		assert.Equal(t, tt.expected, keysOf(result), tt.name)
+	}
+}
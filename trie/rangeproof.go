@@ -0,0 +1,452 @@
+package trie
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/Aleksao998/Merkle-Patricia-Trie/storage"
+	"github.com/Aleksao998/Merkle-Patricia-Trie/storage/mpt"
+	"github.com/Aleksao998/Merkle-Patricia-Trie/trie/crypto"
+	"github.com/Aleksao998/Merkle-Patricia-Trie/trie/nibble"
+	nodes2 "github.com/Aleksao998/Merkle-Patricia-Trie/trie/nodes"
+)
+
+var (
+	errInvalidRange      = errors.New("invalid range")
+	errMissingProofNode  = fmt.Errorf("%w: missing proof node", ErrInvalidProof)
+	errInvalidProofNode  = fmt.Errorf("%w: proof node does not match its hash", ErrInvalidProof)
+	errRangeRootMismatch = errors.New("range does not hash to the expected root")
+)
+
+// RangeProof proves that Keys and Values are all the key/value pairs of a trie
+// starting at a given key, with no pair omitted in between
+type RangeProof struct {
+	Keys   [][]byte
+	Values [][]byte
+	// Proof holds the nodes on the paths to the start key and to the last key.
+	// It is nil if Keys and Values hold the whole trie
+	Proof storage.Storage
+}
+
+// ProveRange returns the key/value pairs starting at the start key, up to limit pairs,
+// together with the edge proofs of the start key and of the last returned key.
+// The trie is locked for the whole proof, so the pairs and edges come from the same version
+func (t *Trie) ProveRange(start []byte, limit int) (*RangeProof, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	pairs, err := t.rangeOf(start, nil, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	rangeProof := &RangeProof{
+		Keys:   make([][]byte, 0, len(pairs)),
+		Values: make([][]byte, 0, len(pairs)),
+		Proof:  mpt.NewMPTMemoryStorage(),
+	}
+
+	for _, pair := range pairs {
+		rangeProof.Keys = append(rangeProof.Keys, pair.Key)
+		rangeProof.Values = append(rangeProof.Values, pair.Value)
+	}
+
+	edges := [][]byte{start}
+	if len(pairs) > 0 {
+		edges = append(edges, pairs[len(pairs)-1].Key)
+	}
+
+	for _, edge := range edges {
+		if _, err := t.proveInto(rangeProof.Proof, t.root, edge); err != nil && !errors.Is(err, ErrKeyNotFound) {
+			return nil, err
+		}
+	}
+
+	return rangeProof, nil
+}
+
+// VerifyRangeProof checks that the key/value pairs of the range proof are exactly the pairs
+// of the trie with the given root hash that start at the start key and end at the last key.
+// It reports whether the trie holds more keys after the last key of the range. The options are
+// those of the proven trie, so WithoutEthereumParity has to be given for a trie created with it
+func VerifyRangeProof(rootHash []byte, start []byte, rangeProof *RangeProof, opts ...Option) (bool, error) {
+	keys, values := rangeProof.Keys, rangeProof.Values
+	legacy := NewTrie(nil, opts...).legacy
+
+	if len(keys) != len(values) {
+		return false, fmt.Errorf("%w: %d keys and %d values", errInvalidRange, len(keys), len(values))
+	}
+
+	for i := range keys {
+		if i == 0 && bytes.Compare(keys[i], start) < 0 {
+			return false, fmt.Errorf("%w: first key is before the start key", errInvalidRange)
+		}
+
+		if i > 0 && bytes.Compare(keys[i-1], keys[i]) >= 0 {
+			return false, fmt.Errorf("%w: keys are not in increasing order", errInvalidRange)
+		}
+
+		// with Ethereum parity the trie never holds empty values, and inserting one would delete the key
+		if len(values[i]) == 0 && !legacy {
+			return false, fmt.Errorf("%w: empty value of key %x", errInvalidRange, keys[i])
+		}
+	}
+
+	// without edge proofs the pairs must make up the whole trie
+	if rangeProof.Proof == nil {
+		tr := NewTrie(mpt.NewMPTMemoryStorage(), opts...)
+
+		for i := range keys {
+			if err := tr.Put(keys[i], values[i]); err != nil {
+				return false, err
+			}
+		}
+
+		hash, err := tr.Hash()
+		if err != nil {
+			return false, err
+		}
+
+		// an empty trie hashes to nil or EmptyRootHash depending on the parity
+		if !bytes.Equal(hash, rootHash) && !(isEmptyRoot(hash) && isEmptyRoot(rootHash)) {
+			return false, errRangeRootMismatch
+		}
+
+		return false, nil
+	}
+
+	if isEmptyRoot(rootHash) {
+		if len(keys) > 0 {
+			return false, errRangeRootMismatch
+		}
+
+		return false, nil
+	}
+
+	tr := NewTrie(rangeProof.Proof, opts...)
+
+	root, err := verifiedProofNode(rangeProof.Proof, rootHash)
+	if err != nil {
+		return false, err
+	}
+
+	// load the nodes on both edge paths from the proof
+	left := nibble.FromBytes(start)
+	if err := resolveProofPath(rangeProof.Proof, &root, left); err != nil {
+		return false, err
+	}
+
+	hasMore := false
+
+	if len(keys) > 0 {
+		right := nibble.FromBytes(keys[len(keys)-1])
+		if err := resolveProofPath(rangeProof.Proof, &root, right); err != nil {
+			return false, err
+		}
+
+		hasMore = hasRightElement(root, right)
+
+		// drop everything the proof says lies within the range, it must be rebuilt from the pairs
+		if err := unsetInternal(&root, left, right); err != nil {
+			return false, err
+		}
+	} else {
+		// an empty range proves there is no key at or after the start key
+		if err := unsetRight(&root, left); err != nil {
+			return false, err
+		}
+	}
+
+	tr.root = root
+
+	for i := range keys {
+		if err := tr.Put(keys[i], values[i]); err != nil {
+			return false, err
+		}
+	}
+
+	hash, err := tr.NodeHash(tr.root)
+	if err != nil {
+		return false, err
+	}
+
+	if !bytes.Equal(hash, rootHash) {
+		return false, errRangeRootMismatch
+	}
+
+	return hasMore, nil
+}
+
+// verifiedProofNode loads a node from the proof and checks that it matches its hash
+func verifiedProofNode(proof storage.Storage, hash []byte) (nodes2.Node, error) {
+	data, err := proof.Get(hash)
+	if err != nil {
+		return nil, fmt.Errorf("%w %x: %w", errMissingProofNode, hash, err)
+	}
+
+	if !bytes.Equal(crypto.Keccak256(data), hash) {
+		return nil, fmt.Errorf("%w: %x", errInvalidProofNode, hash)
+	}
+
+	node, err := decodeNodeData(data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decode node %x: %w", ErrInvalidProof, hash, err)
+	}
+
+	return node, nil
+}
+
+// resolveProofPath replaces the hash nodes on the given path with the nodes held by the proof
+func resolveProofPath(proof storage.Storage, node *nodes2.Node, path []nibble.Nibble) error {
+	for {
+		switch n := (*node).(type) {
+		case nil, *nodes2.LeafNode:
+			return nil
+		case *nodes2.HashNode:
+			actualNode, err := verifiedProofNode(proof, n.Hash)
+			if err != nil {
+				return err
+			}
+
+			*node = actualNode
+		case *nodes2.ExtensionNode:
+			if nibble.CommonPrefixLength(n.Path, path) < len(n.Path) {
+				return nil
+			}
+
+			path = path[len(n.Path):]
+			node = &n.Node
+		case *nodes2.BranchNode:
+			if len(path) == 0 {
+				return nil
+			}
+
+			node = &n.Children[path[0]]
+			path = path[1:]
+		default:
+			return fmt.Errorf("%w: %T", errUnexpectedNode, n)
+		}
+	}
+}
+
+// hasRightElement reports whether the trie holds a key greater than the given path
+func hasRightElement(node nodes2.Node, path []nibble.Nibble) bool {
+	for {
+		switch n := node.(type) {
+		case *nodes2.LeafNode:
+			return nibble.Compare(n.Path, path) > 0
+		case *nodes2.ExtensionNode:
+			cmp := comparePrefix(n.Path, path)
+			if cmp != 0 {
+				return cmp > 0
+			}
+
+			path = path[len(n.Path):]
+			node = n.Node
+		case *nodes2.BranchNode:
+			next := 0
+			if len(path) > 0 {
+				next = int(path[0]) + 1
+			}
+
+			for i := next; i < nodes2.BranchChildrenSize; i++ {
+				if n.Children[i] != nil {
+					return true
+				}
+			}
+
+			if len(path) == 0 {
+				return false
+			}
+
+			node = n.Children[path[0]]
+			path = path[1:]
+		default:
+			return false
+		}
+	}
+}
+
+// unsetInternal removes every key between the left and the right path, both included.
+// The unset functions mark the nodes they visit as modified, dropping their cached hashes
+func unsetInternal(node *nodes2.Node, left, right []nibble.Nibble) error {
+	for {
+		switch n := (*node).(type) {
+		case nil:
+			return nil
+		case *nodes2.LeafNode:
+			if nibble.Compare(n.Path, left) >= 0 && nibble.Compare(n.Path, right) <= 0 {
+				*node = nil
+			}
+
+			return nil
+		case *nodes2.ExtensionNode:
+			n.MarkDirty()
+
+			cmpLeft, cmpRight := comparePrefix(n.Path, left), comparePrefix(n.Path, right)
+
+			switch {
+			case cmpLeft == 0 && cmpRight == 0:
+				left, right = left[len(n.Path):], right[len(n.Path):]
+				node = &n.Node
+			case cmpLeft > 0 && cmpRight < 0:
+				*node = nil
+
+				return nil
+			case cmpLeft == 0 && cmpRight < 0:
+				return unsetRight(&n.Node, left[len(n.Path):])
+			case cmpLeft > 0 && cmpRight == 0:
+				return unsetLeft(&n.Node, right[len(n.Path):])
+			default:
+				// the extension lies entirely outside the range
+				return nil
+			}
+		case *nodes2.BranchNode:
+			n.MarkDirty()
+
+			if len(left) == 0 {
+				n.Value = nil
+
+				if len(right) == 0 {
+					return nil
+				}
+
+				for i := 0; i < int(right[0]); i++ {
+					n.Children[i] = nil
+				}
+
+				return unsetLeft(&n.Children[right[0]], right[1:])
+			}
+
+			if left[0] == right[0] {
+				node = &n.Children[left[0]]
+				left, right = left[1:], right[1:]
+
+				continue
+			}
+
+			for i := left[0] + 1; i < right[0]; i++ {
+				n.Children[i] = nil
+			}
+
+			if err := unsetRight(&n.Children[left[0]], left[1:]); err != nil {
+				return err
+			}
+
+			return unsetLeft(&n.Children[right[0]], right[1:])
+		case *nodes2.HashNode:
+			return fmt.Errorf("%w: %x", errMissingProofNode, n.Hash)
+		default:
+			return fmt.Errorf("%w: %T", errUnexpectedNode, n)
+		}
+	}
+}
+
+// unsetRight removes every key greater than or equal to the given path
+func unsetRight(node *nodes2.Node, path []nibble.Nibble) error {
+	for {
+		switch n := (*node).(type) {
+		case nil:
+			return nil
+		case *nodes2.LeafNode:
+			if nibble.Compare(n.Path, path) >= 0 {
+				*node = nil
+			}
+
+			return nil
+		case *nodes2.ExtensionNode:
+			n.MarkDirty()
+
+			cmp := comparePrefix(n.Path, path)
+			if cmp > 0 {
+				*node = nil
+			}
+
+			if cmp != 0 {
+				return nil
+			}
+
+			path = path[len(n.Path):]
+			node = &n.Node
+		case *nodes2.BranchNode:
+			n.MarkDirty()
+
+			if len(path) == 0 {
+				*node = nil
+
+				return nil
+			}
+
+			for i := path[0] + 1; i < nodes2.BranchChildrenSize; i++ {
+				n.Children[i] = nil
+			}
+
+			node = &n.Children[path[0]]
+			path = path[1:]
+		case *nodes2.HashNode:
+			return fmt.Errorf("%w: %x", errMissingProofNode, n.Hash)
+		default:
+			return fmt.Errorf("%w: %T", errUnexpectedNode, n)
+		}
+	}
+}
+
+// unsetLeft removes every key smaller than or equal to the given path
+func unsetLeft(node *nodes2.Node, path []nibble.Nibble) error {
+	for {
+		switch n := (*node).(type) {
+		case nil:
+			return nil
+		case *nodes2.LeafNode:
+			if nibble.Compare(n.Path, path) <= 0 {
+				*node = nil
+			}
+
+			return nil
+		case *nodes2.ExtensionNode:
+			n.MarkDirty()
+
+			cmp := comparePrefix(n.Path, path)
+			if cmp < 0 {
+				*node = nil
+			}
+
+			if cmp != 0 {
+				return nil
+			}
+
+			path = path[len(n.Path):]
+			node = &n.Node
+		case *nodes2.BranchNode:
+			n.MarkDirty()
+
+			n.Value = nil
+
+			if len(path) == 0 {
+				return nil
+			}
+
+			for i := 0; i < int(path[0]); i++ {
+				n.Children[i] = nil
+			}
+
+			node = &n.Children[path[0]]
+			path = path[1:]
+		case *nodes2.HashNode:
+			return fmt.Errorf("%w: %x", errMissingProofNode, n.Hash)
+		default:
+			return fmt.Errorf("%w: %T", errUnexpectedNode, n)
+		}
+	}
+}
+
+// comparePrefix compares a node path with the beginning of a key path.
+// It returns 0 if the node path is a prefix of the key path
+func comparePrefix(nodePath, keyPath []nibble.Nibble) int {
+	if len(keyPath) > len(nodePath) {
+		keyPath = keyPath[:len(nodePath)]
+	}
+
+	return nibble.Compare(nodePath, keyPath)
+}
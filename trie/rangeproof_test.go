@@ -0,0 +1,192 @@
+package trie
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/Aleksao998/Merkle-Patricia-Trie/storage/mpt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newRangeTestTrie returns a committed trie with the given number of keys and 32 byte values
+func newRangeTestTrie(t *testing.T, count int) *Trie {
+	t.Helper()
+
+	trie := NewTrie(mpt.NewMPTMemoryStorage())
+
+	for i := 0; i < count; i++ {
+		key := []byte(fmt.Sprintf("key-%04d", i*2))
+		require.NoError(t, trie.Put(key, bytes.Repeat(key[len(key)-1:], 32)))
+	}
+
+	_, err := trie.Commit()
+	require.NoError(t, err)
+
+	return trie
+}
+
+// TestRangeProof tests generating and verifying range proofs over several windows of the trie
+func TestRangeProof(t *testing.T) {
+	t.Parallel()
+
+	trie := newRangeTestTrie(t, 100)
+
+	root, err := trie.Hash()
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name    string
+		start   []byte
+		limit   int
+		count   int
+		hasMore bool
+	}{
+		{"from the first key", nil, 10, 10, true},
+		{"start key exists", []byte("key-0040"), 5, 5, true},
+		{"start key is missing", []byte("key-0041"), 5, 5, true},
+		{"single key", []byte("key-0100"), 1, 1, true},
+		{"up to the last key", []byte("key-0150"), 100, 25, false},
+		{"after the last key", []byte("zzz"), 10, 0, false},
+	}
+
+	for _, tt := range testCases {
+		rangeProof, err := trie.ProveRange(tt.start, tt.limit)
+		require.NoError(t, err, tt.name)
+		require.Len(t, rangeProof.Keys, tt.count, tt.name)
+
+		hasMore, err := VerifyRangeProof(root, tt.start, rangeProof)
+		require.NoError(t, err, tt.name)
+		assert.Equal(t, tt.hasMore, hasMore, tt.name)
+	}
+}
+
+// TestRangeProofWholeTrie tests verifying a range without edge proofs
+func TestRangeProofWholeTrie(t *testing.T) {
+	t.Parallel()
+
+	trie := newRangeTestTrie(t, 20)
+
+	root, err := trie.Hash()
+	require.NoError(t, err)
+
+	rangeProof, err := trie.ProveRange(nil, 0)
+	require.NoError(t, err)
+
+	rangeProof.Proof = nil
+
+	_, err = VerifyRangeProof(root, nil, rangeProof)
+	require.NoError(t, err)
+
+	// an invented key with an empty value is rejected rather than inserted as a delete
+	forged := &RangeProof{
+		Keys:   append([][]byte{rangeProof.Keys[0], []byte("key-0001")}, rangeProof.Keys[1:]...),
+		Values: append([][]byte{rangeProof.Values[0], {}}, rangeProof.Values[1:]...),
+	}
+
+	_, err = VerifyRangeProof(root, nil, forged)
+	require.ErrorIs(t, err, errInvalidRange)
+
+	rangeProof.Keys, rangeProof.Values = rangeProof.Keys[1:], rangeProof.Values[1:]
+
+	_, err = VerifyRangeProof(root, nil, rangeProof)
+	require.ErrorIs(t, err, errRangeRootMismatch)
+}
+
+// TestRangeProofTampered tests that omitted, modified or reordered pairs are rejected
+func TestRangeProofTampered(t *testing.T) {
+	t.Parallel()
+
+	trie := newRangeTestTrie(t, 100)
+
+	root, err := trie.Hash()
+	require.NoError(t, err)
+
+	start := []byte("key-0020")
+
+	t.Run("omitted key", func(t *testing.T) {
+		t.Parallel()
+
+		rangeProof, err := trie.ProveRange(start, 10)
+		require.NoError(t, err)
+
+		rangeProof.Keys = append(rangeProof.Keys[:4:4], rangeProof.Keys[5:]...)
+		rangeProof.Values = append(rangeProof.Values[:4:4], rangeProof.Values[5:]...)
+
+		_, err = VerifyRangeProof(root, start, rangeProof)
+		require.ErrorIs(t, err, errRangeRootMismatch)
+	})
+
+	t.Run("omitted first key", func(t *testing.T) {
+		t.Parallel()
+
+		rangeProof, err := trie.ProveRange(start, 10)
+		require.NoError(t, err)
+
+		rangeProof.Keys, rangeProof.Values = rangeProof.Keys[1:], rangeProof.Values[1:]
+
+		_, err = VerifyRangeProof(root, start, rangeProof)
+		require.Error(t, err)
+	})
+
+	t.Run("modified value", func(t *testing.T) {
+		t.Parallel()
+
+		rangeProof, err := trie.ProveRange(start, 10)
+		require.NoError(t, err)
+
+		rangeProof.Values[3] = []byte("tampered")
+
+		_, err = VerifyRangeProof(root, start, rangeProof)
+		require.ErrorIs(t, err, errRangeRootMismatch)
+	})
+
+	t.Run("invented key with empty value", func(t *testing.T) {
+		t.Parallel()
+
+		rangeProof, err := trie.ProveRange(start, 10)
+		require.NoError(t, err)
+
+		// an empty value would be inserted as a delete, leaving the root unchanged
+		rangeProof.Keys = append(rangeProof.Keys[:3:3], append([][]byte{[]byte("key-0025")}, rangeProof.Keys[3:]...)...)
+		rangeProof.Values = append(rangeProof.Values[:3:3], append([][]byte{{}}, rangeProof.Values[3:]...)...)
+
+		_, err = VerifyRangeProof(root, start, rangeProof)
+		require.ErrorIs(t, err, errInvalidRange)
+	})
+
+	t.Run("unordered keys", func(t *testing.T) {
+		t.Parallel()
+
+		rangeProof, err := trie.ProveRange(start, 10)
+		require.NoError(t, err)
+
+		rangeProof.Keys[2], rangeProof.Keys[3] = rangeProof.Keys[3], rangeProof.Keys[2]
+
+		_, err = VerifyRangeProof(root, start, rangeProof)
+		require.ErrorIs(t, err, errInvalidRange)
+	})
+
+	t.Run("empty range hides keys", func(t *testing.T) {
+		t.Parallel()
+
+		rangeProof, err := trie.ProveRange(start, 10)
+		require.NoError(t, err)
+
+		rangeProof.Keys, rangeProof.Values = nil, nil
+
+		_, err = VerifyRangeProof(root, start, rangeProof)
+		require.ErrorIs(t, err, errRangeRootMismatch)
+	})
+
+	t.Run("wrong root", func(t *testing.T) {
+		t.Parallel()
+
+		rangeProof, err := trie.ProveRange(start, 10)
+		require.NoError(t, err)
+
+		_, err = VerifyRangeProof(bytes.Repeat([]byte{1}, 32), start, rangeProof)
+		require.ErrorIs(t, err, errMissingProofNode)
+	})
+}
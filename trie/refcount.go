@@ -0,0 +1,176 @@
+package trie
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	"github.com/Aleksao998/Merkle-Patricia-Trie/storage"
+	"github.com/Aleksao998/Merkle-Patricia-Trie/trie/crypto"
+	nodes2 "github.com/Aleksao998/Merkle-Patricia-Trie/trie/nodes"
+)
+
+// LeafReferences returns the roots of the tries referenced by a value stored in a leaf, like
+// the storage root held by an account of the state trie. Pruning and reference counting follow
+// these roots along with the child nodes, so the tries hanging off the leaves are kept with them
+type LeafReferences func(value []byte) [][]byte
+
+// refCountedNode is a trie node written through the reference counting storage
+type refCountedNode struct {
+	references int      // references from tracked parents and retained roots
+	children   [][]byte // hashes of the nodes referenced by this node
+}
+
+// RefCountedStorage is a storage layer that tracks the references between the trie nodes
+// written through it, similar to the hashdb of go-ethereum. Roots are retained with Reference
+// and released with Dereference, which deletes every node no longer reachable from a retained
+// root. Only nodes written through the layer are tracked, older nodes are never deleted.
+// Other keys, like root pointers and preimages, are passed through untouched
+type RefCountedStorage struct {
+	storage storage.Storage
+	leaves  LeafReferences
+	nodes   map[string]*refCountedNode
+	mu      sync.Mutex
+}
+
+// NewRefCountedStorage wraps the storage with a reference counting layer. The optional leaves
+// function returns the roots referenced by the leaf values, which have to be written first
+func NewRefCountedStorage(storage storage.Storage, leaves LeafReferences) *RefCountedStorage {
+	return &RefCountedStorage{
+		storage: storage,
+		leaves:  leaves,
+		nodes:   make(map[string]*refCountedNode),
+	}
+}
+
+// Has retrieves if a key is present in the underlying storage
+func (r *RefCountedStorage) Has(key []byte) (bool, error) {
+	return r.storage.Has(key)
+}
+
+// Get retrieves the value for a given key from the underlying storage
+func (r *RefCountedStorage) Get(key []byte) ([]byte, error) {
+	return r.storage.Get(key)
+}
+
+// Put stores the value and, if it is a trie node, starts tracking the references it holds
+func (r *RefCountedStorage) Put(key []byte, value []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.storage.Put(key, value); err != nil {
+		return err
+	}
+
+	// nodes are content-addressed, so a node written again holds the same references
+	if _, tracked := r.nodes[string(key)]; tracked || !bytes.Equal(crypto.Keccak256(value), key) {
+		return nil
+	}
+
+	node, err := decodeNodeData(value, nil)
+	if err != nil {
+		// a value that happens to be keyed by its hash but is not a node
+		return nil //nolint:nilerr
+	}
+
+	children := nodeReferences(node, nil, r.leaves)
+	for _, child := range children {
+		if tracked, ok := r.nodes[string(child)]; ok {
+			tracked.references++
+		}
+	}
+
+	r.nodes[string(key)] = &refCountedNode{children: children}
+
+	return nil
+}
+
+// Delete removes the key from the underlying storage and stops tracking it
+func (r *RefCountedStorage) Delete(key []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.nodes, string(key))
+
+	return r.storage.Delete(key)
+}
+
+// Reference retains the root, so its nodes are kept until it is dereferenced.
+// Roots that were not written through the layer are never deleted anyway
+func (r *RefCountedStorage) Reference(root []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if node, ok := r.nodes[string(root)]; ok {
+		node.references++
+	}
+}
+
+// Dereference releases a retained root and deletes the nodes no longer reachable
+// from any retained root. It returns the number of deleted nodes
+func (r *RefCountedStorage) Dereference(root []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	node, ok := r.nodes[string(root)]
+	if !ok || node.references == 0 {
+		return 0, nil
+	}
+
+	node.references--
+
+	deleted := 0
+	stale := [][]byte{root}
+
+	for len(stale) > 0 {
+		hash := stale[len(stale)-1]
+		stale = stale[:len(stale)-1]
+
+		// a node referenced twice by its parent is queued twice
+		node, ok := r.nodes[string(hash)]
+		if !ok || node.references > 0 {
+			continue
+		}
+
+		if err := r.storage.Delete(hash); err != nil {
+			return deleted, fmt.Errorf("failed to delete node %x: %w", hash, err)
+		}
+
+		delete(r.nodes, string(hash))
+		deleted++
+
+		for _, child := range node.children {
+			if tracked, ok := r.nodes[string(child)]; ok {
+				tracked.references--
+				stale = append(stale, child)
+			}
+		}
+	}
+
+	return deleted, nil
+}
+
+// nodeReferences appends the hashes of the nodes referenced by the node, including the
+// references held by its embedded children and, if leaves is not nil, by its values
+func nodeReferences(node nodes2.Node, references [][]byte, leaves LeafReferences) [][]byte {
+	switch n := node.(type) {
+	case *nodes2.HashNode:
+		return append(references, n.Hash)
+	case *nodes2.LeafNode:
+		if leaves != nil {
+			return append(references, leaves(n.Value)...)
+		}
+	case *nodes2.ExtensionNode:
+		return nodeReferences(n.Node, references, leaves)
+	case *nodes2.BranchNode:
+		for _, child := range n.Children {
+			references = nodeReferences(child, references, leaves)
+		}
+
+		if leaves != nil && n.HasValue() {
+			references = append(references, leaves(n.Value)...)
+		}
+	}
+
+	return references
+}
@@ -0,0 +1,196 @@
+package trie
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	mockstorage "github.com/Aleksao998/Merkle-Patricia-Trie/storage/mockStorage"
+	"github.com/Aleksao998/Merkle-Patricia-Trie/trie/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newMapStorage returns a storage backed by the given map, so tests can inspect its content
+func newMapStorage(data map[string][]byte) *mockstorage.MockStorage {
+	return &mockstorage.MockStorage{
+		HasFn: func(key []byte) (bool, error) {
+			_, ok := data[string(key)]
+
+			return ok, nil
+		},
+		GetFn: func(key []byte) ([]byte, error) {
+			value, ok := data[string(key)]
+			if !ok {
+				return nil, ErrKeyNotFound
+			}
+
+			return value, nil
+		},
+		PutFn: func(key []byte, value []byte) error {
+			data[string(key)] = value
+
+			return nil
+		},
+		DeleteFn: func(key []byte) error {
+			delete(data, string(key))
+
+			return nil
+		},
+	}
+}
+
+// storedNodes returns the number of trie nodes in the storage map
+func storedNodes(data map[string][]byte) int {
+	count := 0
+
+	for key, value := range data {
+		if bytes.Equal(crypto.Keccak256(value), []byte(key)) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// reachableNodes adds the hashes of the stored nodes reachable from the root to the set
+func reachableNodes(t *testing.T, trie *Trie, root []byte, reachable map[string]struct{}) {
+	t.Helper()
+
+	if _, ok := reachable[string(root)]; ok {
+		return
+	}
+
+	node, err := trie.DecodeNode(root)
+	require.NoError(t, err)
+
+	reachable[string(root)] = struct{}{}
+
+	for _, child := range nodeReferences(node, nil, nil) {
+		reachableNodes(t, trie, child, reachable)
+	}
+}
+
+// TestRefCountedStorage tests that dereferencing old roots deletes exactly the nodes
+// no longer reachable from a retained root
+func TestRefCountedStorage(t *testing.T) {
+	t.Parallel()
+
+	data := make(map[string][]byte)
+	db := NewRefCountedStorage(newMapStorage(data), nil)
+	trie := NewTrie(db)
+
+	var roots [][]byte
+
+	for version := 0; version < 3; version++ {
+		for i := 0; i < 200; i++ {
+			if i%(version+2) == 0 {
+				key := []byte(fmt.Sprintf("key-%d", i))
+				require.NoError(t, trie.Put(key, bytes.Repeat([]byte{byte(version)}, 40)))
+			}
+		}
+
+		root, err := trie.Commit()
+		require.NoError(t, err)
+
+		db.Reference(root)
+		roots = append(roots, root)
+	}
+
+	deleted, err := db.Dereference(roots[0])
+	require.NoError(t, err)
+	assert.Positive(t, deleted)
+
+	_, err = NewTrieAt(roots[0], db)
+	require.ErrorIs(t, err, errRootNotFound)
+
+	// only the nodes of the retained roots are left
+	reachable := make(map[string]struct{})
+	reachableNodes(t, trie, roots[1], reachable)
+	reachableNodes(t, trie, roots[2], reachable)
+	assert.Equal(t, len(reachable), storedNodes(data))
+
+	_, err = db.Dereference(roots[1])
+	require.NoError(t, err)
+
+	reachable = make(map[string]struct{})
+	reachableNodes(t, trie, roots[2], reachable)
+	assert.Equal(t, len(reachable), storedNodes(data))
+
+	latest, err := NewTrieAt(roots[2], db)
+	require.NoError(t, err)
+
+	it := latest.NewIterator()
+	count := 0
+
+	for it.Next() {
+		count++
+	}
+
+	require.NoError(t, it.Err())
+	// the even keys and the multiples of 3 below 200
+	assert.Equal(t, 133, count)
+
+	hash, err := latest.Hash()
+	require.NoError(t, err)
+	assert.Equal(t, roots[2], hash)
+
+	_, err = db.Dereference(roots[2])
+	require.NoError(t, err)
+	assert.Zero(t, storedNodes(data))
+}
+
+// TestRefCountedStorageLeafReferences tests that the tries referenced by leaf values
+// are retained and released along with the leaves referencing them
+func TestRefCountedStorageLeafReferences(t *testing.T) {
+	t.Parallel()
+
+	// the values of the outer trie are the roots of inner tries
+	leaves := func(value []byte) [][]byte {
+		if len(value) == 32 {
+			return [][]byte{value}
+		}
+
+		return nil
+	}
+
+	data := make(map[string][]byte)
+	db := NewRefCountedStorage(newMapStorage(data), leaves)
+	inner, outer := NewTrie(db), NewTrie(db)
+
+	var innerRoots, outerRoots [][]byte
+
+	for version := 0; version < 2; version++ {
+		for i := 0; i < 20; i++ {
+			require.NoError(t, inner.Put([]byte(fmt.Sprintf("key-%d", i)), bytes.Repeat([]byte{byte(version)}, 40)))
+		}
+
+		innerRoot, err := inner.Commit()
+		require.NoError(t, err)
+
+		require.NoError(t, outer.Put([]byte("inner"), innerRoot))
+
+		outerRoot, err := outer.Commit()
+		require.NoError(t, err)
+
+		db.Reference(outerRoot)
+		innerRoots, outerRoots = append(innerRoots, innerRoot), append(outerRoots, outerRoot)
+	}
+
+	_, err := db.Dereference(outerRoots[0])
+	require.NoError(t, err)
+
+	_, err = NewTrieAt(innerRoots[0], db)
+	require.ErrorIs(t, err, errRootNotFound)
+
+	latest, err := NewTrieAt(innerRoots[1], db)
+	require.NoError(t, err)
+
+	value, err := latest.Get([]byte("key-7"))
+	require.NoError(t, err)
+	assert.Equal(t, bytes.Repeat([]byte{1}, 40), value)
+
+	_, err = db.Dereference(outerRoots[1])
+	require.NoError(t, err)
+	assert.Zero(t, storedNodes(data))
+}
@@ -0,0 +1,115 @@
+package trie
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/Aleksao998/Merkle-Patricia-Trie/storage"
+)
+
+// registryPrefix prefixes the storage keys of the named tries, one key per trie ID
+const registryPrefix = "trieRegistry/"
+
+var (
+	errTrieNotFound = errors.New("trie not found")
+	errEmptyTrieID  = errors.New("trie ID must not be empty")
+)
+
+// Registry keeps track of the named tries sharing one storage.
+// Every named trie has its own root pointer, see WithID. Listing
+// the tries requires a storage implementing storage.Iterable
+type Registry struct {
+	storage storage.Storage
+	mu      sync.Mutex
+}
+
+// NewRegistry returns the registry of the named tries of the storage
+func NewRegistry(storage storage.Storage) *Registry {
+	return &Registry{
+		storage: storage,
+	}
+}
+
+// Open returns the named trie, registering it if it does not exist yet
+func (r *Registry) Open(id string, opts ...Option) (*Trie, error) {
+	if id == "" {
+		return nil, errEmptyTrieID
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	found, err := r.storage.Has(registryKeyOf(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load trie registry: %w", err)
+	}
+
+	if !found {
+		if err := r.storage.Put(registryKeyOf(id), []byte{}); err != nil {
+			return nil, fmt.Errorf("failed to register trie %s: %w", id, err)
+		}
+	}
+
+	return NewTrie(r.storage, append(opts, WithID(id))...), nil
+}
+
+// List returns the IDs of the registered tries in sorted order
+func (r *Registry) List() ([]string, error) {
+	iterable, ok := r.storage.(storage.Iterable)
+	if !ok {
+		return nil, errNotIterable
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var ids []string
+
+	err := iterable.Iterate([]byte(registryPrefix), func(key, _ []byte) bool {
+		if !bytes.HasPrefix(key, []byte(registryPrefix)) {
+			return false
+		}
+
+		ids = append(ids, string(key[len(registryPrefix):]))
+
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load trie registry: %w", err)
+	}
+
+	return ids, nil
+}
+
+// Delete unregisters the named trie and removes its root pointer. The nodes of the trie
+// are content-addressed and may be shared with other tries, so they are left in storage
+func (r *Registry) Delete(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	found, err := r.storage.Has(registryKeyOf(id))
+	if err != nil {
+		return fmt.Errorf("failed to load trie registry: %w", err)
+	}
+
+	if !found {
+		return fmt.Errorf("%w: %s", errTrieNotFound, id)
+	}
+
+	if err := r.storage.Delete(rootPointerKey(id)); err != nil {
+		return fmt.Errorf("failed to delete root pointer of trie %s: %w", id, err)
+	}
+
+	if err := r.storage.Delete(registryKeyOf(id)); err != nil {
+		return fmt.Errorf("failed to unregister trie %s: %w", id, err)
+	}
+
+	return nil
+}
+
+// registryKeyOf returns the storage key registering the trie with the given ID
+func registryKeyOf(id string) []byte {
+	return []byte(registryPrefix + id)
+}
@@ -0,0 +1,105 @@
+package trie
+
+import (
+	"testing"
+
+	"github.com/Aleksao998/Merkle-Patricia-Trie/storage"
+	"github.com/Aleksao998/Merkle-Patricia-Trie/storage/mpt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNamedTries tests that named tries sharing one storage keep independent roots
+func TestNamedTries(t *testing.T) {
+	t.Parallel()
+
+	db := mpt.NewMPTMemoryStorage()
+
+	accounts := NewTrie(db, WithID("accounts"))
+	contract := NewTrie(db, WithID("contract-1"))
+	legacy := NewTrie(db)
+
+	require.NoError(t, accounts.Put([]byte("key"), []byte("account")))
+	require.NoError(t, contract.Put([]byte("key"), []byte("slot")))
+	require.NoError(t, legacy.Put([]byte("key"), []byte("legacy")))
+
+	for _, trie := range []*Trie{accounts, contract, legacy} {
+		_, err := trie.Commit()
+		require.NoError(t, err)
+	}
+
+	testCases := []struct {
+		trie     *Trie
+		expected string
+	}{
+		{NewTrie(db, WithID("accounts")), "account"},
+		{NewTrie(db, WithID("contract-1")), "slot"},
+		{NewTrie(db), "legacy"},
+	}
+
+	for _, tt := range testCases {
+		value, err := tt.trie.Get([]byte("key"))
+		require.NoError(t, err)
+		assert.Equal(t, tt.expected, string(value))
+	}
+}
+
+// TestRegistry tests listing, opening and deleting named tries
+func TestRegistry(t *testing.T) {
+	t.Parallel()
+
+	db := mpt.NewMPTMemoryStorage()
+	registry := NewRegistry(db)
+
+	for _, id := range []string{"storage-b", "accounts", "storage-a"} {
+		trie, err := registry.Open(id)
+		require.NoError(t, err)
+		require.NoError(t, trie.Put([]byte("id"), []byte(id)))
+
+		_, err = trie.Commit()
+		require.NoError(t, err)
+	}
+
+	_, err := registry.Open("")
+	require.ErrorIs(t, err, errEmptyTrieID)
+
+	ids, err := NewRegistry(db).List()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"accounts", "storage-a", "storage-b"}, ids)
+
+	// every trie is registered under its own key, so the tries are listed by iterating the storage
+	found, err := db.Has(registryKeyOf("accounts"))
+	require.NoError(t, err)
+	assert.True(t, found)
+
+	_, err = NewRegistry(struct{ storage.Storage }{db}).List()
+	require.ErrorIs(t, err, errNotIterable)
+
+	reopened, err := registry.Open("storage-a")
+	require.NoError(t, err)
+
+	value, err := reopened.Get([]byte("id"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("storage-a"), value)
+
+	require.NoError(t, registry.Delete("storage-a"))
+	require.ErrorIs(t, registry.Delete("storage-a"), errTrieNotFound)
+
+	ids, err = registry.List()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"accounts", "storage-b"}, ids)
+
+	// a deleted trie is empty once reopened, the others are untouched
+	reopened, err = registry.Open("storage-a")
+	require.NoError(t, err)
+
+	_, err = reopened.Get([]byte("id"))
+	require.ErrorIs(t, err, ErrKeyNotFound)
+
+	other, err := registry.Open("storage-b")
+	require.NoError(t, err)
+
+	value, err = other.Get([]byte("id"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("storage-b"), value)
+}
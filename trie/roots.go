@@ -0,0 +1,149 @@
+package trie
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Aleksao998/Merkle-Patricia-Trie/storage"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// rootHistoryKey is the storage key of the recent roots of the trie without ID
+const rootHistoryKey = "rootHistory"
+
+// rootHistoryKeyOf returns the storage key of the recent roots of a trie, see WithRootHistory
+func rootHistoryKeyOf(id string) []byte {
+	if id == "" {
+		return []byte(rootHistoryKey)
+	}
+
+	return []byte(rootHistoryKey + "/" + id)
+}
+
+// recordRoot adds the new head root to the recent roots of the trie, dropping the oldest ones
+func (t *Trie) recordRoot(hash []byte) error {
+	roots, err := loadRootHistory(t.storage, t.id)
+	if err != nil {
+		return err
+	}
+
+	if len(roots) > 0 && bytes.Equal(roots[0], hash) {
+		return nil
+	}
+
+	roots = append([][]byte{hash}, roots...)
+	if len(roots) > t.history {
+		roots = roots[:t.history]
+	}
+
+	data, err := rlp.EncodeToBytes(roots)
+	if err != nil {
+		return fmt.Errorf("failed to encode root history: %w", err)
+	}
+
+	if err := t.storage.Put(rootHistoryKeyOf(t.id), data); err != nil {
+		return fmt.Errorf("failed to store root history: %w", err)
+	}
+
+	return nil
+}
+
+// loadRootHistory returns the recent roots of the trie with the given ID, the newest first
+func loadRootHistory(db storage.Storage, id string) ([][]byte, error) {
+	found, err := db.Has(rootHistoryKeyOf(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load root history: %w", err)
+	}
+
+	if !found {
+		return nil, nil
+	}
+
+	data, err := db.Get(rootHistoryKeyOf(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load root history: %w", err)
+	}
+
+	var roots [][]byte
+	if err := rlp.DecodeBytes(data, &roots); err != nil {
+		return nil, fmt.Errorf("failed to decode root history: %w", err)
+	}
+
+	return roots, nil
+}
+
+// HeadRoots returns the roots of all the tries of the storage, to keep them when pruning.
+// These are the roots the default and the named root pointers point to, and up to the given
+// number of most recent roots of each trie opened with WithRootHistory. The named tries are
+// the ones of the Registry, along with the other root pointers. Both are only found if the storage
+// is iterable, otherwise only the roots of the default trie are returned
+func HeadRoots(db storage.Storage, recent int) ([][]byte, error) {
+	ids := []string{""}
+
+	if iterable, ok := db.(storage.Iterable); ok {
+		registered, err := NewRegistry(db).List()
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, registered...)
+
+		// the pointers are collected first, as some storages can not be read while iterating
+		err = iterable.Iterate([]byte(rootHashKey), func(key, _ []byte) bool {
+			if !bytes.HasPrefix(key, []byte(rootHashKey)) {
+				return false
+			}
+
+			if id, ok := strings.CutPrefix(string(key), rootHashKey+"/"); ok && id != "" {
+				ids = append(ids, id)
+			}
+
+			return true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list root pointers: %w", err)
+		}
+	}
+
+	sort.Strings(ids)
+
+	var (
+		roots [][]byte
+		seen  = make(map[string]struct{})
+	)
+
+	keep := func(root []byte) {
+		if _, ok := seen[string(root)]; ok || root == nil {
+			return
+		}
+
+		seen[string(root)] = struct{}{}
+		roots = append(roots, root)
+	}
+
+	for i, id := range ids {
+		if i > 0 && ids[i-1] == id {
+			continue
+		}
+
+		head, err := NewTrie(db, WithID(id)).GetRootHash()
+		if err != nil {
+			return nil, err
+		}
+
+		keep(head)
+
+		history, err := loadRootHistory(db, id)
+		if err != nil {
+			return nil, err
+		}
+
+		for j := 0; j < len(history) && j < recent; j++ {
+			keep(history[j])
+		}
+	}
+
+	return roots, nil
+}
@@ -0,0 +1,233 @@
+package trie
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/Aleksao998/Merkle-Patricia-Trie/storage"
+	"github.com/Aleksao998/Merkle-Patricia-Trie/trie/crypto"
+)
+
+// preimagePrefix is the storage namespace of the key preimages of secure tries
+const preimagePrefix = "secure-key-"
+
+var errPreimageNotFound = errors.New("key preimage not found")
+
+// SecureTrie wraps a trie and keys every entry by the Keccak256 hash of its key,
+// which bounds the depth of the trie and stops attackers from building deep paths.
+// Optionally it records the key preimages so the original keys can be recovered
+type SecureTrie struct {
+	trie      *Trie
+	storage   storage.Storage
+	preimages map[string][]byte // nil if preimages are not recorded
+	mu        sync.Mutex
+}
+
+// NewSecureTrie returns a secure trie over the given storage, configured by the options of the
+// wrapped trie. If recordPreimages is set, the original keys are persisted on commit
+func NewSecureTrie(storage storage.Storage, recordPreimages bool, opts ...Option) *SecureTrie {
+	s := &SecureTrie{
+		trie:    NewTrie(storage, opts...),
+		storage: storage,
+	}
+
+	if recordPreimages {
+		s.preimages = make(map[string][]byte)
+	}
+
+	return s
+}
+
+// NewSecureTrieAt returns a secure trie opened at a previously committed root.
+// Like with NewTrieAt, Commit does not move the root pointer of the storage
+func NewSecureTrieAt(root []byte, storage storage.Storage, recordPreimages bool, opts ...Option) (*SecureTrie, error) {
+	t, err := NewTrieAt(root, storage, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	s := NewSecureTrie(storage, recordPreimages, opts...)
+	s.trie = t
+
+	return s, nil
+}
+
+// Get retrieves the value associated with a given key
+func (s *SecureTrie) Get(key []byte) ([]byte, error) {
+	return s.trie.Get(crypto.Keccak256(key))
+}
+
+// Put inserts or updates a value associated with a given key
+func (s *SecureTrie) Put(key []byte, value []byte) error {
+	hashedKey := crypto.Keccak256(key)
+
+	if err := s.trie.Put(hashedKey, value); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.preimages == nil {
+		return nil
+	}
+
+	// an empty value deletes the key, unless Ethereum parity is disabled
+	if len(value) == 0 && !s.trie.legacy {
+		delete(s.preimages, string(hashedKey))
+
+		return nil
+	}
+
+	s.preimages[string(hashedKey)] = append([]byte{}, key...)
+
+	return nil
+}
+
+// Del removes the key from the trie
+func (s *SecureTrie) Del(key []byte) error {
+	hashedKey := crypto.Keccak256(key)
+
+	if err := s.trie.Del(hashedKey); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// a deleted key needs no preimage, unless it is committed already
+	delete(s.preimages, string(hashedKey))
+
+	return nil
+}
+
+// Hash returns the root hash of the trie
+func (s *SecureTrie) Hash() ([]byte, error) {
+	return s.trie.Hash()
+}
+
+// Proof returns the Merkle-proof of the key. The proof is built for the hashed key,
+// so it has to be verified against crypto.Keccak256(key)
+func (s *SecureTrie) Proof(key []byte) (storage.Storage, error) {
+	return s.trie.Proof(crypto.Keccak256(key))
+}
+
+// ProofList returns the Merkle-proof of the key as an ordered list of nodes, built for the hashed key.
+// Like Proof, it returns ErrKeyNotFound together with the proof of a missing key
+func (s *SecureTrie) ProofList(key []byte) (*Proof, error) {
+	return s.trie.ProofList(crypto.Keccak256(key))
+}
+
+// Commit persists the recorded key preimages and the trie, and returns the trie root key
+func (s *SecureTrie) Commit() ([]byte, error) {
+	s.mu.Lock()
+
+	for hashedKey, key := range s.preimages {
+		if err := s.storage.Put(preimageKey([]byte(hashedKey)), key); err != nil {
+			s.mu.Unlock()
+
+			return nil, fmt.Errorf("failed to store key preimage: %w", err)
+		}
+
+		delete(s.preimages, hashedKey)
+	}
+
+	s.mu.Unlock()
+
+	return s.trie.Commit()
+}
+
+// Preimage returns the original key of a hashed key
+func (s *SecureTrie) Preimage(hashedKey []byte) ([]byte, error) {
+	s.mu.Lock()
+	key, ok := s.preimages[string(hashedKey)]
+	s.mu.Unlock()
+
+	if ok {
+		return key, nil
+	}
+
+	found, err := s.storage.Has(preimageKey(hashedKey))
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, fmt.Errorf("%w: %x", errPreimageNotFound, hashedKey)
+	}
+
+	return s.storage.Get(preimageKey(hashedKey))
+}
+
+// NewIterator returns an iterator over the entries of the trie in hashed key order
+func (s *SecureTrie) NewIterator() *SecureIterator {
+	return &SecureIterator{
+		Iterator: s.trie.NewIterator(),
+		secure:   s,
+	}
+}
+
+// SecureIterator walks a secure trie and resolves the original keys from their preimages
+type SecureIterator struct {
+	*Iterator
+	secure *SecureTrie
+	key    []byte
+	err    error
+}
+
+// Next moves the iterator to the next entry and loads its original key
+func (it *SecureIterator) Next() bool {
+	it.key = nil
+
+	if it.err != nil || !it.Iterator.Next() {
+		return false
+	}
+
+	key, err := it.secure.Preimage(it.Iterator.Key())
+	if err != nil {
+		it.err = err
+
+		return false
+	}
+
+	it.key = key
+
+	return true
+}
+
+// All returns the remaining entries keyed by their original keys as a push iterator
+// that has the shape of iter.Seq2[[]byte, []byte]. Err should be checked once it returns
+func (it *SecureIterator) All() func(yield func(key, value []byte) bool) {
+	return func(yield func(key, value []byte) bool) {
+		for it.Next() {
+			if !yield(it.Key(), it.Value()) {
+				return
+			}
+		}
+	}
+}
+
+// Key returns the original key of the current entry
+func (it *SecureIterator) Key() []byte {
+	return it.key
+}
+
+// HashedKey returns the hashed key of the current entry, as stored in the trie
+func (it *SecureIterator) HashedKey() []byte {
+	return it.Iterator.Key()
+}
+
+// Err returns the error that stopped the iteration, if any
+func (it *SecureIterator) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+
+	return it.Iterator.Err()
+}
+
+// preimageKey returns the storage key of the preimage of a hashed key
+func preimageKey(hashedKey []byte) []byte {
+	return append([]byte(preimagePrefix), hashedKey...)
+}
@@ -0,0 +1,141 @@
+package trie
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Aleksao998/Merkle-Patricia-Trie/storage/mpt"
+	"github.com/Aleksao998/Merkle-Patricia-Trie/trie/crypto"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	ethereumTrie "github.com/ethereum/go-ethereum/trie"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSecureTrieMatchesEthereum tests that the secure trie hashes to the same root
+// as the go-ethereum state trie for the same entries
+func TestSecureTrieMatchesEthereum(t *testing.T) {
+	t.Parallel()
+
+	secure := NewSecureTrie(mpt.NewMPTMemoryStorage(), false)
+
+	ethTrie, err := ethereumTrie.NewStateTrie(
+		ethereumTrie.StateTrieID(types.EmptyRootHash),
+		ethereumTrie.NewDatabase(rawdb.NewMemoryDatabase(), nil),
+	)
+	require.NoError(t, err)
+
+	for i := 0; i < 100; i++ {
+		key := []byte(fmt.Sprintf("key%d", i))
+		value := []byte(fmt.Sprintf("value%d", i))
+
+		require.NoError(t, secure.Put(key, value))
+		ethTrie.MustUpdate(key, value)
+	}
+
+	require.NoError(t, secure.Del([]byte("key7")))
+	ethTrie.MustDelete([]byte("key7"))
+
+	root, err := secure.Hash()
+	require.NoError(t, err)
+	assert.Equal(t, ethTrie.Hash().Bytes(), root)
+
+	value, err := secure.Get([]byte("key8"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("value8"), value)
+
+	proof, err := secure.Proof([]byte("key8"))
+	require.NoError(t, err)
+
+	proven, err := VerifyProof(root, crypto.Keccak256([]byte("key8")), proof)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("value8"), proven)
+}
+
+// TestSecureTriePreimages tests that recorded preimages let iteration return the original keys
+func TestSecureTriePreimages(t *testing.T) {
+	t.Parallel()
+
+	db := mpt.NewMPTMemoryStorage()
+	secure := NewSecureTrie(db, true)
+
+	expected := make(map[string]string)
+
+	for i := 0; i < 20; i++ {
+		key, value := fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i)
+		expected[key] = value
+
+		require.NoError(t, secure.Put([]byte(key), []byte(value)))
+	}
+
+	_, err := secure.Commit()
+	require.NoError(t, err)
+
+	// a fresh wrapper reads the preimages back from storage
+	reopened := NewSecureTrie(db, true)
+	found := make(map[string]string)
+
+	it := reopened.NewIterator()
+	it.All()(func(key, value []byte) bool {
+		found[string(key)] = string(value)
+
+		return true
+	})
+
+	require.NoError(t, it.Err())
+	assert.Equal(t, expected, found)
+
+	// without preimages the original keys cannot be recovered
+	withoutPreimages := NewSecureTrie(mpt.NewMPTMemoryStorage(), false)
+	require.NoError(t, withoutPreimages.Put([]byte("key"), []byte("value")))
+
+	it = withoutPreimages.NewIterator()
+	require.False(t, it.Next())
+	require.ErrorIs(t, it.Err(), errPreimageNotFound)
+}
+
+// TestSecureTrieDeletePreimages tests that deleted keys do not leave preimages behind,
+// and that the options are passed to the wrapped trie
+func TestSecureTrieDeletePreimages(t *testing.T) {
+	t.Parallel()
+
+	db := mpt.NewMPTMemoryStorage()
+	secure := NewSecureTrie(db, true)
+
+	require.NoError(t, secure.Put([]byte("deleted"), []byte{}))
+	require.NoError(t, secure.Put([]byte("removed"), []byte("value")))
+	require.NoError(t, secure.Del([]byte("removed")))
+	require.NoError(t, secure.Put([]byte("kept"), []byte("value")))
+
+	_, err := secure.Commit()
+	require.NoError(t, err)
+
+	for _, key := range []string{"deleted", "removed"} {
+		found, err := db.Has(preimageKey(crypto.Keccak256([]byte(key))))
+		require.NoError(t, err)
+		assert.False(t, found, key)
+	}
+
+	preimage, err := secure.Preimage(crypto.Keccak256([]byte("kept")))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("kept"), preimage)
+
+	// without Ethereum parity an empty value is stored, so its preimage is kept
+	legacy := NewSecureTrie(mpt.NewMPTMemoryStorage(), true, WithoutEthereumParity())
+	require.NoError(t, legacy.Put([]byte("empty"), []byte{}))
+
+	root, err := legacy.Commit()
+	require.NoError(t, err)
+
+	preimage, err = legacy.Preimage(crypto.Keccak256([]byte("empty")))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("empty"), preimage)
+
+	reopened, err := NewSecureTrieAt(root, legacy.storage, false, WithoutEthereumParity())
+	require.NoError(t, err)
+
+	value, err := reopened.Get([]byte("empty"))
+	require.NoError(t, err)
+	assert.Empty(t, value)
+}
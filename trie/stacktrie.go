@@ -0,0 +1,250 @@
+package trie
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/Aleksao998/Merkle-Patricia-Trie/storage"
+	"github.com/Aleksao998/Merkle-Patricia-Trie/trie/crypto"
+	"github.com/Aleksao998/Merkle-Patricia-Trie/trie/nibble"
+	nodes2 "github.com/Aleksao998/Merkle-Patricia-Trie/trie/nodes"
+)
+
+var (
+	errUnsortedKey = errors.New("keys must be inserted in strictly increasing order")
+	errEmptyValue  = errors.New("empty values can not be inserted")
+)
+
+// StackTrie builds a trie from keys inserted in strictly increasing order. Only the
+// nodes on the path of the last inserted key are held in memory: every subtree on its
+// left can no longer change, so it is hashed as soon as the next key passes it, and
+// stored right away if a storage is set. The root is the same as the one of a Trie
+// holding the same keys
+type StackTrie struct {
+	root    nodes2.Node
+	storage storage.Storage
+	encoder *Trie  // encodes and hashes the nodes
+	last    []byte // last inserted key, nil before the first one
+}
+
+// NewStackTrie returns an empty stack trie. The storage is optional,
+// without one the finished subtrees are only hashed
+func NewStackTrie(storage storage.Storage) *StackTrie {
+	return &StackTrie{
+		storage: storage,
+		encoder: NewTrie(storage),
+	}
+}
+
+// Put inserts a key, which has to be greater than every key inserted before
+func (st *StackTrie) Put(key []byte, value []byte) error {
+	if st.last != nil && bytes.Compare(key, st.last) <= 0 {
+		return fmt.Errorf("%w: %x after %x", errUnsortedKey, key, st.last)
+	}
+
+	if len(value) == 0 {
+		return fmt.Errorf("%w: %x", errEmptyValue, key)
+	}
+
+	if err := st.insert(&st.root, nibble.FromBytes(key), value); err != nil {
+		return err
+	}
+
+	// the copy is not nil even for an empty key, so an empty key is not accepted twice
+	st.last = append([]byte{}, key...)
+
+	return nil
+}
+
+// insert adds the value at the path below the node. Since the path is greater than
+// every path below the node, it diverges on the right of the nodes on the last path
+func (st *StackTrie) insert(currentNode *nodes2.Node, path []nibble.Nibble, value []byte) error {
+	for {
+		switch node := (*currentNode).(type) {
+		case nil:
+			*currentNode = nodes2.NewLeafNode(path, value)
+
+			return nil
+		case *nodes2.LeafNode:
+			commonLength := nibble.CommonPrefixLength(node.Path, path)
+			branch := nodes2.NewBranchNode()
+
+			if commonLength == len(node.Path) {
+				// the leaf key is a prefix of the new key, its value moves to the branch
+				branch.SetValue(node.Value)
+			} else {
+				left, err := st.finish(nodes2.NewLeafNode(node.Path[commonLength+1:], node.Value))
+				if err != nil {
+					return err
+				}
+
+				branch.SetChild(node.Path[commonLength], left)
+			}
+
+			branch.SetChild(path[commonLength], nodes2.NewLeafNode(path[commonLength+1:], value))
+			*currentNode = wrapInExtension(path[:commonLength], branch)
+
+			return nil
+		case *nodes2.ExtensionNode:
+			commonLength := nibble.CommonPrefixLength(node.Path, path)
+			if commonLength == len(node.Path) {
+				node.MarkDirty()
+
+				path = path[commonLength:]
+				currentNode = &node.Node
+
+				continue
+			}
+
+			// the new path diverges inside the extension, the part below the divergence is finished
+			left, err := st.finish(wrapInExtension(node.Path[commonLength+1:], node.Node))
+			if err != nil {
+				return err
+			}
+
+			branch := nodes2.NewBranchNode()
+			branch.SetChild(node.Path[commonLength], left)
+			branch.SetChild(path[commonLength], nodes2.NewLeafNode(path[commonLength+1:], value))
+			*currentNode = wrapInExtension(path[:commonLength], branch)
+
+			return nil
+		case *nodes2.BranchNode:
+			// the children on the left of the new path are finished
+			for i := 0; i < int(path[0]); i++ {
+				if child := node.Children[i]; child != nil {
+					finished, err := st.finish(child)
+					if err != nil {
+						return err
+					}
+
+					node.Children[i] = finished
+				}
+			}
+
+			node.MarkDirty()
+
+			currentNode = &node.Children[path[0]]
+			path = path[1:]
+		case *nodes2.HashNode:
+			// a finished subtree is never on the path of a greater key
+			return fmt.Errorf("%w: %x", errUnsortedKey, path)
+		default:
+			return fmt.Errorf("%w: %T", errUnexpectedNode, node)
+		}
+	}
+}
+
+// finish hashes a subtree that can no longer change and returns the reference its
+// parent holds. Nodes shorter than 32 bytes stay embedded, others are stored if a
+// storage is set and replaced by their hash
+func (st *StackTrie) finish(node nodes2.Node) (nodes2.Node, error) {
+	switch n := node.(type) {
+	case *nodes2.ExtensionNode:
+		child, err := st.finish(n.Node)
+		if err != nil {
+			return nil, err
+		}
+
+		n.Node = child
+	case *nodes2.BranchNode:
+		for i, child := range n.Children {
+			if child == nil {
+				continue
+			}
+
+			finished, err := st.finish(child)
+			if err != nil {
+				return nil, err
+			}
+
+			n.Children[i] = finished
+		}
+	case *nodes2.HashNode:
+		return n, nil
+	}
+
+	encoded, err := st.encoder.encodeNode(node)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(encoded) < 32 {
+		return node, nil
+	}
+
+	hash, err := st.store(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	return nodes2.NewHashNode(hash), nil
+}
+
+// store writes the node encoding to the storage, if any, and returns its hash
+func (st *StackTrie) store(encoded []byte) ([]byte, error) {
+	hash := crypto.Keccak256(encoded)
+
+	if st.storage == nil {
+		return hash, nil
+	}
+
+	if err := st.storage.Put(hash, encoded); err != nil {
+		return nil, fmt.Errorf("failed to store node %x: %w", hash, err)
+	}
+
+	return hash, nil
+}
+
+// Hash returns the root hash of the keys inserted so far, or EmptyRootHash if there are none.
+// More keys can be inserted afterwards
+func (st *StackTrie) Hash() ([]byte, error) {
+	if st.root == nil {
+		return st.encoder.emptyRoot(), nil
+	}
+
+	return st.encoder.NodeHash(st.root)
+}
+
+// Commit stores the remaining nodes, including the root, and returns the root hash.
+// The stack trie is reset and can be reused for a new set of keys. The root is not
+// made the head of the storage, the trie can be opened with NewTrieAt
+func (st *StackTrie) Commit() ([]byte, error) {
+	root := st.root
+	st.root, st.last = nil, nil
+
+	if root == nil {
+		return st.encoder.emptyRoot(), nil
+	}
+
+	// the root is always stored, even if it is shorter than 32 bytes
+	finished, err := st.finish(root)
+	if err != nil {
+		return nil, err
+	}
+
+	if hashNode, ok := finished.(*nodes2.HashNode); ok {
+		return hashNode.Hash, nil
+	}
+
+	encoded, err := st.encoder.encodeNode(finished)
+	if err != nil {
+		return nil, err
+	}
+
+	return st.store(encoded)
+}
+
+// wrapInExtension returns the node behind an extension with the given path, merging
+// it with the node if it is an extension itself. An empty path returns the node
+func wrapInExtension(path []nibble.Nibble, node nodes2.Node) nodes2.Node {
+	if len(path) == 0 {
+		return node
+	}
+
+	if extension, ok := node.(*nodes2.ExtensionNode); ok {
+		return nodes2.NewExtension(appendPath(path, extension.Path), extension.Node)
+	}
+
+	return nodes2.NewExtension(path, node)
+}
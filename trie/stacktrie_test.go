@@ -0,0 +1,177 @@
+package trie
+
+import (
+	"bytes"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/Aleksao998/Merkle-Patricia-Trie/storage/mpt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stackTrieTestKeys returns sorted keys of different lengths, some being prefixes of others
+func stackTrieTestKeys() [][]byte {
+	r := rand.New(rand.NewSource(1))
+	unique := make(map[string]struct{})
+
+	for _, key := range iteratorTestKeys() {
+		unique[string(key)] = struct{}{}
+	}
+
+	for i := 0; i < 2000; i++ {
+		key := make([]byte, r.Intn(6)+1)
+		r.Read(key)
+
+		unique[string(key)] = struct{}{}
+	}
+
+	keys := make([][]byte, 0, len(unique))
+	for key := range unique {
+		keys = append(keys, []byte(key))
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(keys[i], keys[j]) < 0
+	})
+
+	return keys
+}
+
+// TestStackTrieMatchesTrie tests that the stack trie computes the same root as a trie
+// holding the same keys, and stores a trie that can be opened at that root
+func TestStackTrieMatchesTrie(t *testing.T) {
+	t.Parallel()
+
+	db := mpt.NewMPTMemoryStorage()
+	stackTrie := NewStackTrie(db)
+	trie := NewTrie(mpt.NewMPTMemoryStorage())
+
+	hash, err := stackTrie.Hash()
+	require.NoError(t, err)
+	assert.Equal(t, EmptyRootHash, hash)
+
+	keys := stackTrieTestKeys()
+
+	for i, key := range keys {
+		// short values produce nodes embedded in their parent
+		value := bytes.Repeat(key, i%5+1)
+
+		require.NoError(t, stackTrie.Put(key, value))
+		require.NoError(t, trie.Put(key, value))
+
+		if i%100 == 0 {
+			expected, err := trie.Hash()
+			require.NoError(t, err)
+
+			hash, err := stackTrie.Hash()
+			require.NoError(t, err)
+			require.Equal(t, expected, hash, "key %d", i)
+		}
+	}
+
+	// finished subtrees are flushed before the commit
+	stored := 0
+
+	require.NoError(t, db.Iterate(nil, func(key, value []byte) bool {
+		stored++
+
+		return true
+	}))
+	require.Greater(t, stored, 100)
+
+	expected, err := trie.Hash()
+	require.NoError(t, err)
+
+	root, err := stackTrie.Commit()
+	require.NoError(t, err)
+	require.Equal(t, expected, root)
+
+	committed, err := NewTrieAt(root, db)
+	require.NoError(t, err)
+
+	for i, key := range keys {
+		value, err := committed.Get(key)
+		require.NoError(t, err)
+		require.Equal(t, bytes.Repeat(key, i%5+1), value)
+	}
+
+	// the stack trie is reset by the commit
+	hash, err = stackTrie.Hash()
+	require.NoError(t, err)
+	assert.Equal(t, EmptyRootHash, hash)
+}
+
+// TestStackTrieSingleKey tests that a root shorter than 32 bytes is hashed and stored
+func TestStackTrieSingleKey(t *testing.T) {
+	t.Parallel()
+
+	db := mpt.NewMPTMemoryStorage()
+	stackTrie := NewStackTrie(db)
+	require.NoError(t, stackTrie.Put([]byte("key"), []byte("value")))
+
+	trie := NewTrie(mpt.NewMPTMemoryStorage())
+	require.NoError(t, trie.Put([]byte("key"), []byte("value")))
+
+	expected, err := trie.Hash()
+	require.NoError(t, err)
+
+	root, err := stackTrie.Commit()
+	require.NoError(t, err)
+	assert.Equal(t, expected, root)
+
+	has, err := db.Has(root)
+	require.NoError(t, err)
+	assert.True(t, has)
+}
+
+// TestStackTrieInvalidInput tests that unsorted keys and empty values are rejected
+func TestStackTrieInvalidInput(t *testing.T) {
+	t.Parallel()
+
+	stackTrie := NewStackTrie(nil)
+	require.NoError(t, stackTrie.Put([]byte("dog"), []byte("puppy")))
+
+	assert.ErrorIs(t, stackTrie.Put([]byte("dog"), []byte("puppy")), errUnsortedKey)
+	assert.ErrorIs(t, stackTrie.Put([]byte("do"), []byte("verb")), errUnsortedKey)
+	assert.ErrorIs(t, stackTrie.Put([]byte("doge"), nil), errEmptyValue)
+
+	// rejected keys leave the stack trie untouched
+	require.NoError(t, stackTrie.Put([]byte("doge"), []byte("coin")))
+
+	trie := NewTrie(mpt.NewMPTMemoryStorage())
+	require.NoError(t, trie.Put([]byte("dog"), []byte("puppy")))
+	require.NoError(t, trie.Put([]byte("doge"), []byte("coin")))
+
+	expected, err := trie.Hash()
+	require.NoError(t, err)
+
+	root, err := stackTrie.Commit()
+	require.NoError(t, err)
+	assert.Equal(t, expected, root)
+}
+
+// TestStackTrieEmptyKey tests that an empty key, which is the smallest key, is inserted once
+func TestStackTrieEmptyKey(t *testing.T) {
+	t.Parallel()
+
+	stackTrie := NewStackTrie(nil)
+	require.NoError(t, stackTrie.Put([]byte{}, []byte("empty")))
+
+	assert.ErrorIs(t, stackTrie.Put([]byte{}, []byte("again")), errUnsortedKey)
+	assert.ErrorIs(t, stackTrie.Put(nil, []byte("again")), errUnsortedKey)
+
+	require.NoError(t, stackTrie.Put([]byte("key"), []byte("value")))
+
+	trie := NewTrie(mpt.NewMPTMemoryStorage())
+	require.NoError(t, trie.Put([]byte{}, []byte("empty")))
+	require.NoError(t, trie.Put([]byte("key"), []byte("value")))
+
+	expected, err := trie.Hash()
+	require.NoError(t, err)
+
+	root, err := stackTrie.Commit()
+	require.NoError(t, err)
+	assert.Equal(t, expected, root)
+}
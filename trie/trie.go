@@ -7,12 +7,21 @@ import (
 	"sync"
 
 	"github.com/Aleksao998/Merkle-Patricia-Trie/storage"
+	"github.com/Aleksao998/Merkle-Patricia-Trie/trie/crypto"
 	"github.com/Aleksao998/Merkle-Patricia-Trie/trie/nibble"
 	nodes2 "github.com/Aleksao998/Merkle-Patricia-Trie/trie/nodes"
+	"github.com/ethereum/go-ethereum/rlp"
 )
 
 var (
-	errKeyNotFound = errors.New("key not found")
+	// EmptyRootHash is the root hash of an empty trie, the hash of the encoding of an empty string
+	EmptyRootHash = crypto.Keccak256(rlp.EmptyString)
+
+	// ErrKeyNotFound is returned when the key is not in the trie
+	ErrKeyNotFound = errors.New("key not found")
+
+	errUnexpectedNode = errors.New("unexpected node type encountered while traversing the trie")
+	errRootNotFound   = errors.New("root node not found in storage")
 )
 
 type Trie struct {
@@ -20,19 +29,89 @@ type Trie struct {
 	storage  storage.Storage
 	mu       sync.RWMutex
 	rootHash []byte
+	id       string     // namespace of the root pointer in storage
+	workers  int        // size of the hashing worker pool, sequential below 2
+	detached bool       // opened at a given root, the stored root pointer is neither read nor written
+	paths    *pathStore // nodes stored by path instead of hash, nil for the hash scheme
+	batch    *nodeBatch // nodes collected by a parallel commit, nil otherwise
+	history  int        // number of recent head roots recorded, see WithRootHistory
+	resolved bool       // the root node was loaded or built, a nil root is then an empty trie
+	legacy   bool       // Ethereum parity disabled: an empty trie hashes to nil and empty values are stored
+
+	journal     []journalEntry // node pointers replaced since the first checkpoint
+	checkpoints []int          // journal length at each checkpoint
 }
 
-func NewTrie(storage storage.Storage) *Trie {
-	return &Trie{
+func NewTrie(storage storage.Storage, opts ...Option) *Trie {
+	t := &Trie{
 		storage: storage,
 	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	if t.paths != nil {
+		t.paths.storage, t.paths.owner = storage, t.id
+	}
+
+	return t
+}
+
+// NewTrieAt opens the trie at a previously committed root. Nodes are content-addressed
+// and never overwritten, so any committed version can be queried. The trie is copy-on-write:
+// Commit stores the modified nodes and returns the new root without moving the root
+// pointer of the storage. SetRootHash makes a root the head of the storage, e.g. to roll back.
+// With the path scheme only the latest nodes are stored, so only the versions within the
+// kept history can be opened, and the opened trie is read-only. A nil root or EmptyRootHash
+// opens an empty trie
+func NewTrieAt(root []byte, storage storage.Storage, opts ...Option) (*Trie, error) {
+	t := NewTrie(storage, opts...)
+	t.detached = true
+
+	if isEmptyRoot(root) {
+		return t, nil
+	}
+
+	if t.paths != nil {
+		if err := t.paths.openAt(root); err != nil {
+			return nil, err
+		}
+
+		t.rootHash = root
+
+		return t, nil
+	}
+
+	found, err := storage.Has(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load root node %x: %w", root, err)
+	}
+
+	if !found {
+		return nil, fmt.Errorf("%w: %x", errRootNotFound, root)
+	}
+
+	t.rootHash = root
+
+	return t, nil
 }
 
-func (t *Trie) Hash() []byte {
-	t.getRootHash()
+// Hash returns the root hash of the trie, or EmptyRootHash if the trie is empty
+func (t *Trie) Hash() ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.getRootHash(); err != nil {
+		return nil, err
+	}
 
 	if t.root == nil {
-		return nil // Empty Trie
+		return t.emptyRoot(), nil
+	}
+
+	if err := t.hashParallel(t.root); err != nil {
+		return nil, err
 	}
 
 	return t.NodeHash(t.root)
@@ -44,37 +123,42 @@ func (t *Trie) Proof(key []byte) (storage.Storage, error) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	t.getRootHash()
+	if err := t.getRootHash(); err != nil {
+		return nil, err
+	}
 
 	return t.GenerateProof(t.root, key)
 }
 
 // Get retrieves the value associated with a given key in the trie
 func (t *Trie) Get(key []byte) ([]byte, error) {
+	if err := t.loadRoot(); err != nil {
+		return nil, err
+	}
+
 	t.mu.RLock()
 	defer t.mu.RUnlock()
 
 	// convert the byte key to a nibble path for easier traversal
 	nibblePath := nibble.FromBytes(key)
 
-	currentNode := &t.root
-
-	t.getRootHash()
+	currentNode := t.root
 
 	// loop until a value is found, or it's determined the key is not in the trie
 	for {
-		switch node := (*currentNode).(type) {
+		switch node := currentNode.(type) {
 		case nil:
 			// if a nil node is encountered, the key isn't in the trie
-			return nil, errKeyNotFound
+			return nil, ErrKeyNotFound
 		case *nodes2.HashNode:
-			// If a HashNode is encountered, fetch the actual node from storage
-			actualNode, err := t.DecodeNode(node.Hash)
+			// If a HashNode is encountered, fetch the actual node from storage.
+			// Readers only hold the read lock, so the loaded node is not kept in the trie
+			actualNode, err := t.resolve(node)
 			if err != nil {
 				return nil, err
 			}
 
-			*currentNode = actualNode
+			currentNode = actualNode
 
 			continue
 		case *nodes2.LeafNode:
@@ -82,7 +166,7 @@ func (t *Trie) Get(key []byte) ([]byte, error) {
 			commonLength := nibble.CommonPrefixLength(node.Path, nibblePath)
 			if commonLength != len(node.Path) || commonLength != len(nibblePath) {
 				// if they don't match exactly, the key isn't in the trie
-				return nil, errKeyNotFound
+				return nil, ErrKeyNotFound
 			}
 			// if they do match, return the leaf node's value
 			return node.Value, nil
@@ -94,14 +178,14 @@ func (t *Trie) Get(key []byte) ([]byte, error) {
 					return value, nil
 				}
 
-				return nil, errKeyNotFound
+				return nil, ErrKeyNotFound
 			}
 
 			// otherwise, extract the next child nibble and the remaining path
 			child, remaining := nibblePath[0], nibblePath[1:]
 			nibblePath = remaining
 			// move to the child node based on the nibble
-			currentNode = &node.Children[child]
+			currentNode = node.Children[child]
 
 			// continue the loop with the child node
 			continue
@@ -110,22 +194,31 @@ func (t *Trie) Get(key []byte) ([]byte, error) {
 			commonLength := nibble.CommonPrefixLength(node.Path, nibblePath)
 			if commonLength < len(node.Path) {
 				// if they don't share the full extension path, the key isn't in the trie
-				return nil, errKeyNotFound
+				return nil, ErrKeyNotFound
 			}
 
 			// move to the next segment of the nibble path
 			nibblePath = nibblePath[commonLength:]
 			// move to the child node of the extension
-			currentNode = &node.Node
+			currentNode = node.Node
 		default:
-			// if an unexpected node type is encountered, panic
-			panic("Unexpected node type encountered while traversing the trie")
+			// if an unexpected node type is encountered, return an error
+			return nil, fmt.Errorf("%w: %T", errUnexpectedNode, node)
 		}
 	}
 }
 
-// Put inserts or updates a value associated with a given key in the trie
-func (t *Trie) Put(key []byte, value []byte) {
+// Put inserts or updates a value associated with a given key in the trie.
+// As in Ethereum, an empty value deletes the key
+func (t *Trie) Put(key []byte, value []byte) error {
+	if len(value) == 0 && !t.legacy {
+		if err := t.Del(key); err != nil && !errors.Is(err, ErrKeyNotFound) {
+			return err
+		}
+
+		return nil
+	}
+
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
@@ -133,83 +226,116 @@ func (t *Trie) Put(key []byte, value []byte) {
 	nibblePath := nibble.FromBytes(key)
 	currentNode := &t.root
 
-	t.getRootHash()
+	if err := t.getRootHash(); err != nil {
+		return err
+	}
 
 	// loop until a value is set or updated
 	for {
 		switch node := (*currentNode).(type) {
 		case nil:
 			// if current node is nil, create a new leaf node with the remaining nibble path and value
-			*currentNode = nodes2.NewLeafNode(nibblePath, value)
+			t.replaceNode(currentNode, nodes2.NewLeafNode(nibblePath, value))
 
-			return
+			return nil
 
 		case *nodes2.LeafNode:
 			// handle the logic of inserting a key-value pair when encountering a leaf node
 			t.handleLeafNodeInsert(currentNode, node, nibblePath, value)
 
-			return
+			return nil
 
 		case *nodes2.BranchNode:
-			node.Dirty = true
+			node = t.mutableBranch(currentNode, node)
+			node.MarkDirty()
 
 			// if there's no remaining path, set the value directly on the branch node
 			if len(nibblePath) == 0 {
 				node.SetValue(value)
 
-				return
+				return nil
 			}
 			// update the current node to the child pointed by the next nibble and continue to next segment
 			currentNode = &node.Children[nibblePath[0]]
 			nibblePath = nibblePath[1:]
 
 		case *nodes2.ExtensionNode:
-			node.Dirty = true
+			node = t.mutableExtension(currentNode, node)
+			node.MarkDirty()
 
 			// calculate the length of the common prefix with the extension node's path
 			commonLength := nibble.CommonPrefixLength(node.Path, nibblePath)
 			// if they don't share the full extension path, handle the logic of inserting in such scenario
 			if commonLength < len(node.Path) {
-				t.handleExtensionNodeInsert(currentNode, node, nibblePath, value, commonLength)
-
-				return
+				return t.handleExtensionNodeInsert(currentNode, node, nibblePath, value, commonLength)
 			}
 			// move to the next segment of the nibble path and the child node of the extension
 			nibblePath = nibblePath[commonLength:]
 			currentNode = &node.Node
 		case *nodes2.HashNode:
-			actualNode, err := t.DecodeNode(node.Hash)
+			actualNode, err := t.resolve(node)
 			if err != nil {
-				panic(err.Error())
+				return err
 			}
 
 			*currentNode = actualNode
 		default:
-			// if an unexpected node type is encountered, panic
-			panic("Unexpected node type encountered while traversing the trie")
+			// if an unexpected node type is encountered, return an error
+			return fmt.Errorf("%w: %T", errUnexpectedNode, node)
 		}
 	}
 }
 
-// Commit saves the trie in persistent storage
-// and returns the trie root key.
-func (t *Trie) Commit() []byte {
+// Commit saves the modified nodes of the trie in persistent storage
+// and returns the trie root key, EmptyRootHash if it is empty. Committed subtrees are collapsed to
+// hash nodes, so only the root stays in memory. The stored root pointer
+// is updated unless the trie was opened with NewTrieAt. Commit discards the checkpoints
+func (t *Trie) Commit() ([]byte, error) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	rootKey, err := t.commit(t.root)
+	if t.paths != nil && t.detached {
+		return nil, errReadOnlyTrie
+	}
+
+	if err := t.getRootHash(); err != nil {
+		return nil, err
+	}
+
+	// committed nodes are collapsed in place, so the journal can not be replayed past a commit
+	t.journal, t.checkpoints = nil, nil
+
+	if err := t.hashParallel(t.root); err != nil {
+		return nil, fmt.Errorf("failed to commit the trie: %w", err)
+	}
+
+	commit := t.commit
+	if t.workers > 1 && t.paths == nil {
+		commit = t.commitParallel
+	}
+
+	rootKey, err := commit(t.root)
 	if err != nil {
-		panic("Failed to commit the trie: " + err.Error())
+		return nil, fmt.Errorf("failed to commit the trie: %w", err)
 	}
 
-	if err := t.SetRootHash(rootKey); err != nil {
-		panic("Failed to set root hash: " + err.Error())
+	if t.paths != nil {
+		if err := t.paths.flush(); err != nil {
+			return nil, fmt.Errorf("failed to commit the trie: %w", err)
+		}
 	}
 
-	// Set the root to nil to release the in-memory storage of the trie.
-	t.root = nil
+	if t.detached {
+		t.rootHash = rootKey
+	} else if err := t.setRootHash(rootKey); err != nil {
+		return nil, err
+	}
 
-	return rootKey
+	if rootKey == nil {
+		return t.emptyRoot(), nil
+	}
+
+	return rootKey, nil
 }
 
 // Del removes the key from the trie
@@ -224,50 +350,56 @@ func (t *Trie) Del(key []byte) error {
 
 	currentNode := &t.root
 
-	t.getRootHash()
+	if err := t.getRootHash(); err != nil {
+		return err
+	}
 
 	// loop until the key is found and removed or until it's clear the key doesn't exist
 	for {
 		switch node := (*currentNode).(type) {
 		case nil:
 			// if the currentNode is nil, the key is not in the trie
-			return errKeyNotFound
+			return ErrKeyNotFound
 		case *nodes2.HashNode:
-			actualNode, err := t.DecodeNode(node.Hash)
+			actualNode, err := t.resolve(node)
 			if err != nil {
-				panic(err.Error())
+				return err
 			}
 
 			*currentNode = actualNode
 		case *nodes2.LeafNode:
 			// if the key matches with the leaf node's path, delete the leaf node
 			if nibble.Equal(node.Path, nibblePath) {
-				*currentNode = nil
+				t.replaceNode(currentNode, nil)
 
-				t.compressPath(pathStack)
+				markPathDirty(pathStack)
 
-				return nil
+				return t.compressPath(pathStack)
 			}
 
-			return errKeyNotFound
+			return ErrKeyNotFound
 		case *nodes2.BranchNode:
+			node = t.mutableBranch(currentNode, node)
+
 			// if there's no remaining path and the branch node has the value, delete the value
 			if len(nibblePath) == 0 {
 				if !node.HasValue() {
-					return errKeyNotFound
+					return ErrKeyNotFound
 				}
 
 				node.ClearValue()
 
 				if node.ChildCount() == 1 {
-					t.compressBranchNode(node, currentNode)
+					if err := t.compressBranchNode(node, currentNode); err != nil {
+						return err
+					}
 				}
 
-				node.Dirty = true
+				node.MarkDirty()
 
-				t.compressPath(pathStack)
+				markPathDirty(pathStack)
 
-				return nil
+				return t.compressPath(pathStack)
 			}
 			// update the current node and path and keep track of the nodes encountered
 			pathStack = append(pathStack, currentNode)
@@ -275,10 +407,12 @@ func (t *Trie) Del(key []byte) error {
 			nibblePath = nibblePath[1:]
 			currentNode = &node.Children[childNibble]
 		case *nodes2.ExtensionNode:
+			node = t.mutableExtension(currentNode, node)
+
 			// if the key doesn't share the full extension path, return key not found
 			commonLength := nibble.CommonPrefixLength(node.Path, nibblePath)
 			if commonLength < len(node.Path) {
-				return errKeyNotFound
+				return ErrKeyNotFound
 			}
 
 			// update the current node and path and keep track of the nodes encountered
@@ -286,24 +420,40 @@ func (t *Trie) Del(key []byte) error {
 			nibblePath = nibblePath[commonLength:]
 			currentNode = &node.Node
 		default:
-			// if an unexpected node type is encountered, panic
-			panic("Unexpected node type encountered while traversing the trie")
+			// if an unexpected node type is encountered, return an error
+			return fmt.Errorf("%w: %T", errUnexpectedNode, node)
+		}
+	}
+}
+
+// markPathDirty marks the nodes on the path of a deleted key as modified
+func markPathDirty(pathStack []*nodes2.Node) {
+	for _, node := range pathStack {
+		switch n := (*node).(type) {
+		case *nodes2.BranchNode:
+			n.MarkDirty()
+		case *nodes2.ExtensionNode:
+			n.MarkDirty()
 		}
 	}
 }
 
 // compressPath compresses the path after deletion if possible
-func (t *Trie) compressPath(pathStack []*nodes2.Node) {
+func (t *Trie) compressPath(pathStack []*nodes2.Node) error {
 	for len(pathStack) > 0 {
 		node := pathStack[len(pathStack)-1]
 
 		switch n := (*node).(type) {
 		case *nodes2.BranchNode:
-			// compress the branch node if it has only one child left and no value
-			if n.ChildCount() == 1 && !n.HasValue() {
-				t.compressBranchNode(n, node)
-			} else {
-				break
+			switch {
+			case n.ChildCount() == 1 && !n.HasValue():
+				// compress the branch node if it has only one child left and no value
+				if err := t.compressBranchNode(n, node); err != nil {
+					return err
+				}
+			case n.ChildCount() == 0 && n.HasValue():
+				// a branch node left with only its value becomes a leaf holding it
+				t.replaceNode(node, nodes2.NewLeafNode([]nibble.Nibble{}, n.Value))
 			}
 
 		case *nodes2.ExtensionNode:
@@ -311,17 +461,17 @@ func (t *Trie) compressPath(pathStack []*nodes2.Node) {
 			childNode := n.Node
 			switch child := childNode.(type) {
 			case *nodes2.ExtensionNode:
-				mergedPath := append(n.Path, child.Path...)
+				mergedPath := appendPath(n.Path, child.Path)
 				newNode := nodes2.NewExtension(mergedPath, child.Node)
-				*node = newNode
+				t.replaceNode(node, newNode)
 			case *nodes2.LeafNode:
-				mergedPath := append(n.Path, child.Path...)
+				mergedPath := appendPath(n.Path, child.Path)
 				newNode := nodes2.NewLeafNode(mergedPath, child.Value)
-				*node = newNode
+				t.replaceNode(node, newNode)
 			case *nodes2.BranchNode:
 				if child.ChildCount() == 0 && child.HasValue() {
 					newNode := nodes2.NewLeafNode(n.Path, child.Value)
-					*node = newNode
+					t.replaceNode(node, newNode)
 				}
 			default:
 				break
@@ -330,50 +480,110 @@ func (t *Trie) compressPath(pathStack []*nodes2.Node) {
 
 		pathStack = pathStack[:len(pathStack)-1]
 	}
+
+	return nil
 }
 
 // compressBranchNode compresses a branch node into a leaf or extension node
 // This happens when a branch node has only one child. Instead of keeping
 // the branch node structure, the trie can be made more efficient by
 // compressing the branch node
-func (t *Trie) compressBranchNode(node *nodes2.BranchNode, parentNode *nodes2.Node) {
+func (t *Trie) compressBranchNode(node *nodes2.BranchNode, parentNode *nodes2.Node) error {
 	// iterate over the children of the branch node
 	for i, child := range node.Children {
 		if child != nil {
+			// a committed child has to be loaded, since leaf and extension children merge with the branch
+			if hashNode, ok := child.(*nodes2.HashNode); ok {
+				actualNode, err := t.resolve(hashNode)
+				if err != nil {
+					return err
+				}
+
+				child = actualNode
+			}
+
 			// check the type of the child node
 			switch c := child.(type) {
 			case *nodes2.LeafNode:
 				// if the child is a leaf node, merge the branch node and leaf node paths
 				mergedPath := append([]nibble.Nibble{nibble.Nibble(i)}, c.Path...)
-				*parentNode = nodes2.NewLeafNode(mergedPath, c.Value)
+				t.replaceNode(parentNode, nodes2.NewLeafNode(mergedPath, c.Value))
+			case *nodes2.ExtensionNode:
+				// if the child is an extension node, prepend the branch nibble to its path
+				mergedPath := append([]nibble.Nibble{nibble.Nibble(i)}, c.Path...)
+				t.replaceNode(parentNode, nodes2.NewExtension(mergedPath, c.Node))
 			default:
 				// if the child is any other type, create a new extension node with the child
-				*parentNode = nodes2.NewExtension([]nibble.Nibble{nibble.Nibble(i)}, child)
+				t.replaceNode(parentNode, nodes2.NewExtension([]nibble.Nibble{nibble.Nibble(i)}, child))
 			}
 			// exit the loop once the compression is done for the only child
 			break
 		}
 	}
+
+	return nil
 }
 
-// getRootHash gets root hash from storage if nil and if available
-func (t *Trie) getRootHash() {
-	// If root is nil, attempt to fetch root node from storage
-	if t.root == nil {
-		rootHash, _ := t.GetRootHash()
+// loadRoot loads the root node under the write lock if it is not loaded yet,
+// so readers holding the read lock never replace the root
+func (t *Trie) loadRoot() error {
+	t.mu.RLock()
+	loaded := t.root != nil || t.resolved
+	t.mu.RUnlock()
+
+	if loaded {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.getRootHash()
+}
+
+// getRootHash gets root hash from storage if nil and if available.
+// It may replace the root, so the write lock has to be held
+func (t *Trie) getRootHash() error {
+	// If root is nil, attempt to fetch root node from storage,
+	// unless it was loaded already and the trie was emptied since
+	if t.root == nil && !t.resolved {
+		rootHash, err := t.GetRootHash()
+		if err != nil {
+			return err
+		}
 
 		// If rootHash is nil, it indicates an empty trie and we can just return
 		if rootHash == nil {
-			return
+			return nil
 		}
 
 		rootNode, err := t.DecodeNode(rootHash)
 		if err != nil {
-			panic(err.Error())
+			return fmt.Errorf("failed to load root node: %w", err)
 		}
 
 		t.root = rootNode
 	}
+
+	if t.root != nil {
+		t.resolved = true
+	}
+
+	return nil
+}
+
+// emptyRoot returns the root hash reported for an empty trie
+func (t *Trie) emptyRoot() []byte {
+	if t.legacy {
+		return nil
+	}
+
+	return bytes.Clone(EmptyRootHash)
+}
+
+// isEmptyRoot reports whether the root hash is the one of an empty trie, nil or EmptyRootHash
+func isEmptyRoot(root []byte) bool {
+	return len(root) == 0 || bytes.Equal(root, EmptyRootHash)
 }
 
 // handleLeafNodeInsert handles the insertion logic when encountering a leaf node in the trie
@@ -384,9 +594,11 @@ func (t *Trie) handleLeafNodeInsert(currentNode *nodes2.Node, leafNode *nodes2.L
 	commonLength := nibble.CommonPrefixLength(leafNode.Path, nibblePath)
 
 	// check if the leaf node's path is the same as the input nibble path
-	if commonLength == len(nibblePath) && commonLength == len(leafNode.Path) && !bytes.Equal(leafNode.Value, value) {
+	if commonLength == len(nibblePath) && commonLength == len(leafNode.Path) {
 		// if they're the same and the values differ, update the current node to the new value
-		*currentNode = nodes2.NewLeafNode(nibblePath, value)
+		if !bytes.Equal(leafNode.Value, value) {
+			t.replaceNode(currentNode, nodes2.NewLeafNode(nibblePath, value))
+		}
 
 		return
 	}
@@ -413,17 +625,17 @@ func (t *Trie) handleLeafNodeInsert(currentNode *nodes2.Node, leafNode *nodes2.L
 
 	// if there's a common prefix, create an extension node with the branch node as a child
 	if commonLength > 0 {
-		*currentNode = nodes2.NewExtension(nibblePath[:commonLength], branchNode)
+		t.replaceNode(currentNode, nodes2.NewExtension(nibblePath[:commonLength], branchNode))
 	} else {
 		// if no common prefix, set the current node to the branch node directly
-		*currentNode = branchNode
+		t.replaceNode(currentNode, branchNode)
 	}
 }
 
 // handleExtensionNodeInsert handles the insertion logic when encountering an extension node in the trie
 //
 //nolint:lll
-func (t *Trie) handleExtensionNodeInsert(currentNode *nodes2.Node, extNode *nodes2.ExtensionNode, nibblePath []nibble.Nibble, value []byte, commonLength int) {
+func (t *Trie) handleExtensionNodeInsert(currentNode *nodes2.Node, extNode *nodes2.ExtensionNode, nibblePath []nibble.Nibble, value []byte, commonLength int) error {
 	// derive the common nibbles, the branching nibble, and the remaining nibbles from the extension node's path
 	extNibbles := extNode.Path[:commonLength]
 	branchNibble := extNode.Path[commonLength]
@@ -450,15 +662,17 @@ func (t *Trie) handleExtensionNodeInsert(currentNode *nodes2.Node, extNode *node
 		// if they are the same length, set the value on the branch node
 		branchNode.SetValue(value)
 	} else {
-		// if there's an unexpected match of more nibbles than provided, panic
-		panic(fmt.Sprintf("too many matched (%v > %v)", commonLength, len(nibblePath)))
+		// if there's an unexpected match of more nibbles than provided, return an error
+		return fmt.Errorf("too many matched (%v > %v)", commonLength, len(nibblePath))
 	}
 
 	// if there are no common nibbles, set the current node to the branch node
 	if len(extNibbles) == 0 {
-		*currentNode = branchNode
+		t.replaceNode(currentNode, branchNode)
 	} else {
 		// if there are common nibbles, create an extension node with the branch node as a child
-		*currentNode = nodes2.NewExtension(extNibbles, branchNode)
+		t.replaceNode(currentNode, nodes2.NewExtension(extNibbles, branchNode))
 	}
+
+	return nil
 }
@@ -1,9 +1,13 @@
 package trie
 
 import (
+	"bytes"
+	"fmt"
 	"testing"
 
+	mockstorage "github.com/Aleksao998/Merkle-Patricia-Trie/storage/mockStorage"
 	"github.com/Aleksao998/Merkle-Patricia-Trie/storage/mpt"
+	nodes2 "github.com/Aleksao998/Merkle-Patricia-Trie/trie/nodes"
 	"github.com/ethereum/go-ethereum/common"
 	ethereumTrie "github.com/ethereum/go-ethereum/trie"
 	"github.com/stretchr/testify/assert"
@@ -23,7 +27,8 @@ func TestGetPutDelBasicAfterCommit(t *testing.T) {
 		trie.Put([]byte("dog"), []byte("dog"))
 		trie.Put([]byte("dor"), []byte("dor"))
 
-		_ = trie.Commit()
+		_, err := trie.Commit()
+		require.NoError(t, err)
 
 		val, err := trie.Get([]byte("dog"))
 		require.Nil(t, err)
@@ -43,11 +48,14 @@ func TestGetPutDelBasicAfterCommit(t *testing.T) {
 		trie.Put([]byte("dog"), []byte("dog"))
 		trie.Put([]byte("dor"), []byte("dor"))
 
-		originalHash := trie.Hash()
+		originalHash, err := trie.Hash()
+		require.NoError(t, err)
 
-		_ = trie.Commit()
+		_, err = trie.Commit()
+		require.NoError(t, err)
 
-		newHash := trie.Hash()
+		newHash, err := trie.Hash()
+		require.NoError(t, err)
 
 		assert.Equal(t, originalHash, newHash)
 	})
@@ -61,13 +69,18 @@ func TestGetPutDelBasicAfterCommit(t *testing.T) {
 		trie.Put([]byte("dog"), []byte("dog"))
 		trie.Put([]byte("dor"), []byte("dor"))
 
-		_ = trie.Commit()
+		_, err := trie.Commit()
+		require.NoError(t, err)
 
 		keyToProof := []byte("dog")
 		proof, err := trie.Proof(keyToProof)
 
 		assert.Nil(t, err, "Failed to generate proof")
-		hashByte := common.BytesToHash(trie.Hash())
+
+		rootHash, err := trie.Hash()
+		require.NoError(t, err)
+
+		hashByte := common.BytesToHash(rootHash)
 
 		value, err := ethereumTrie.VerifyProof(hashByte, keyToProof, proof)
 
@@ -87,18 +100,22 @@ func TestGetPutDelBasicAfterCommit(t *testing.T) {
 		originalTrie.Put([]byte("dogger"), []byte("dor"))
 		originalTrie.Put([]byte("cat"), []byte("cat"))
 
-		originalHash := originalTrie.Hash()
+		originalHash, err := originalTrie.Hash()
+		require.NoError(t, err)
 
 		trie := NewTrie(db)
 
 		trie.Put([]byte("dog"), []byte("dog"))
 		trie.Put([]byte("dor"), []byte("dor"))
-		trie.Commit()
+		_, err = trie.Commit()
+		require.NoError(t, err)
 		trie.Put([]byte("dogger"), []byte("dor"))
-		trie.Commit()
+		_, err = trie.Commit()
+		require.NoError(t, err)
 		trie.Put([]byte("cat"), []byte("cat"))
 
-		newHash := trie.Hash()
+		newHash, err := trie.Hash()
+		require.NoError(t, err)
 		assert.Equal(t, originalHash, newHash, "Mismatch in oriignal and new hash")
 	})
 
@@ -111,19 +128,281 @@ func TestGetPutDelBasicAfterCommit(t *testing.T) {
 		originalTrie.Put([]byte("dog"), []byte("dog"))
 		originalTrie.Put([]byte("dor"), []byte("dor"))
 
-		originalHash := originalTrie.Hash()
+		originalHash, err := originalTrie.Hash()
+		require.NoError(t, err)
 
 		trie := NewTrie(db)
 
 		trie.Put([]byte("dog"), []byte("dog"))
 		trie.Put([]byte("dor"), []byte("dor"))
 		trie.Put([]byte("dogger"), []byte("dor"))
-		trie.Commit()
+		_, err = trie.Commit()
+		require.NoError(t, err)
 
-		err := trie.Del([]byte("dogger"))
+		err = trie.Del([]byte("dogger"))
 		require.Nil(t, err)
 
-		newHash := trie.Hash()
+		newHash, err := trie.Hash()
+		require.NoError(t, err)
 		assert.Equal(t, originalHash, newHash, "Mismatch in oriignal and new hash")
 	})
 }
+
+// TestInlineNodesRoundTrip tests that children shorter than 32 bytes are embedded in their
+// parent on commit, are not stored separately, and are decoded back when the trie is reloaded
+func TestInlineNodesRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	entries := map[string]string{
+		"a": "1", "b": "2", "do": "x", "dog": "y", "doge": "z",
+		"c": "cat", "car": "c", "horse": "stallion with a value longer than thirty two bytes",
+	}
+
+	memory := mpt.NewMPTMemoryStorage()
+	stored := make(map[string]int)
+	db := &mockstorage.MockStorage{
+		HasFn: memory.Has,
+		GetFn: memory.Get,
+		PutFn: func(key []byte, value []byte) error {
+			stored[string(key)] = len(value)
+
+			return memory.Put(key, value)
+		},
+	}
+
+	trie := NewTrie(db)
+
+	for key, value := range entries {
+		require.NoError(t, trie.Put([]byte(key), []byte(value)))
+	}
+
+	originalHash, err := trie.Hash()
+	require.NoError(t, err)
+
+	rootKey, err := trie.Commit()
+	require.NoError(t, err)
+	assert.Equal(t, originalHash, rootKey)
+
+	// only the root may be stored with an encoding shorter than 32 bytes
+	for key, size := range stored {
+		if key != rootHashKey && key != string(rootKey) {
+			assert.GreaterOrEqual(t, size, 32, "node %x", key)
+		}
+	}
+
+	reloaded := NewTrie(db)
+
+	for key, value := range entries {
+		got, err := reloaded.Get([]byte(key))
+		require.NoError(t, err, key)
+		assert.Equal(t, value, string(got), key)
+
+		proof, err := NewTrie(db).Proof([]byte(key))
+		require.NoError(t, err, key)
+
+		proven, err := ethereumTrie.VerifyProof(common.BytesToHash(rootKey), []byte(key), proof)
+		require.NoError(t, err, key)
+		assert.Equal(t, value, string(proven), key)
+
+		proven, err = VerifyProof(rootKey, []byte(key), proof)
+		require.NoError(t, err, key)
+		assert.Equal(t, value, string(proven), key)
+	}
+
+	iterated := 0
+
+	it := NewTrie(db).NewIterator()
+	for it.Next() {
+		assert.Equal(t, entries[string(it.Key())], string(it.Value()))
+
+		iterated++
+	}
+
+	require.NoError(t, it.Err())
+	assert.Equal(t, len(entries), iterated)
+
+	reloadedHash, err := reloaded.Hash()
+	require.NoError(t, err)
+	assert.Equal(t, originalHash, reloadedHash)
+
+	// updates on top of the reloaded trie must match a trie built in memory
+	require.NoError(t, reloaded.Put([]byte("dot"), []byte("w")))
+	require.NoError(t, reloaded.Del([]byte("a")))
+
+	expected := NewTrie(mpt.NewMPTMemoryStorage())
+
+	for key, value := range entries {
+		if key != "a" {
+			require.NoError(t, expected.Put([]byte(key), []byte(value)))
+		}
+	}
+
+	require.NoError(t, expected.Put([]byte("dot"), []byte("w")))
+
+	expectedHash, err := expected.Hash()
+	require.NoError(t, err)
+
+	updatedHash, err := reloaded.Hash()
+	require.NoError(t, err)
+	assert.Equal(t, expectedHash, updatedHash)
+}
+
+// TestCommitWritesOnlyDirtyNodes tests that a commit only stores the nodes modified since the last commit
+func TestCommitWritesOnlyDirtyNodes(t *testing.T) {
+	t.Parallel()
+
+	memory := mpt.NewMPTMemoryStorage()
+	writes := 0
+	db := &mockstorage.MockStorage{
+		HasFn: memory.Has,
+		GetFn: memory.Get,
+		PutFn: func(key []byte, value []byte) error {
+			writes++
+
+			return memory.Put(key, value)
+		},
+	}
+
+	trie := NewTrie(db)
+	expected := NewTrie(mpt.NewMPTMemoryStorage())
+
+	for i := 0; i < 500; i++ {
+		key := []byte(fmt.Sprintf("key-%04d", i))
+		value := bytes.Repeat(key, 4)
+
+		require.NoError(t, trie.Put(key, value))
+		require.NoError(t, expected.Put(key, value))
+	}
+
+	_, err := trie.Commit()
+	require.NoError(t, err)
+
+	fullCommitWrites := writes
+
+	// reading nodes does not make them dirty, only the root pointer is written
+	_, err = trie.Get([]byte("key-0123"))
+	require.NoError(t, err)
+
+	writes = 0
+	_, err = trie.Commit()
+	require.NoError(t, err)
+	assert.Equal(t, 1, writes)
+
+	// an update rewrites the nodes on its path and the root pointer
+	require.NoError(t, trie.Put([]byte("key-0321"), []byte("updated")))
+	require.NoError(t, expected.Put([]byte("key-0321"), []byte("updated")))
+
+	writes = 0
+	rootKey, err := trie.Commit()
+	require.NoError(t, err)
+	assert.Less(t, writes, 10)
+	assert.Less(t, writes, fullCommitWrites/20)
+
+	expectedHash, err := expected.Hash()
+	require.NoError(t, err)
+	assert.Equal(t, expectedHash, rootKey)
+
+	// so does a deletion
+	require.NoError(t, trie.Del([]byte("key-0042")))
+	require.NoError(t, expected.Del([]byte("key-0042")))
+
+	writes = 0
+	rootKey, err = trie.Commit()
+	require.NoError(t, err)
+	assert.Less(t, writes, 10)
+	assert.Less(t, writes, fullCommitWrites/20)
+
+	expectedHash, err = expected.Hash()
+	require.NoError(t, err)
+	assert.Equal(t, expectedHash, rootKey)
+
+	// the committed root is clean and collapsed
+	assert.Equal(t, rootKey, storedHash(trie.root))
+
+	root, ok := trie.root.(*nodes2.ExtensionNode)
+	require.True(t, ok)
+	assert.IsType(t, &nodes2.HashNode{}, root.Node)
+
+	value, err := NewTrie(db).Get([]byte("key-0321"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("updated"), value)
+}
+
+// TestNewTrieAt tests opening the trie at historical roots, updating a historical
+// version without moving the stored root pointer, and rolling back to an older root
+func TestNewTrieAt(t *testing.T) {
+	t.Parallel()
+
+	db := mpt.NewMPTMemoryStorage()
+	head := NewTrie(db)
+
+	roots := make([][]byte, 0, 3)
+
+	for version := 0; version < 3; version++ {
+		for i := 0; i < 50; i++ {
+			key := []byte(fmt.Sprintf("key-%d", i))
+			require.NoError(t, head.Put(key, []byte(fmt.Sprintf("value-%d-%d", version, i))))
+		}
+
+		require.NoError(t, head.Put([]byte(fmt.Sprintf("version-%d", version)), []byte("added")))
+
+		root, err := head.Commit()
+		require.NoError(t, err)
+
+		roots = append(roots, root)
+	}
+
+	for version, root := range roots {
+		historical, err := NewTrieAt(root, db)
+		require.NoError(t, err)
+
+		value, err := historical.Get([]byte("key-7"))
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("value-%d-7", version), string(value))
+
+		_, err = historical.Get([]byte(fmt.Sprintf("version-%d", version+1)))
+		require.ErrorIs(t, err, ErrKeyNotFound)
+
+		hash, err := historical.Hash()
+		require.NoError(t, err)
+		assert.Equal(t, root, hash)
+	}
+
+	// committing a historical version stores a new root but leaves the head untouched
+	historical, err := NewTrieAt(roots[0], db)
+	require.NoError(t, err)
+	require.NoError(t, historical.Put([]byte("key-7"), []byte("fork")))
+
+	forkRoot, err := historical.Commit()
+	require.NoError(t, err)
+
+	headRoot, err := NewTrie(db).Hash()
+	require.NoError(t, err)
+	assert.Equal(t, roots[2], headRoot)
+
+	fork, err := NewTrieAt(forkRoot, db)
+	require.NoError(t, err)
+
+	value, err := fork.Get([]byte("key-7"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("fork"), value)
+
+	// rolling back makes an old root the head of the storage
+	rollback, err := NewTrieAt(roots[1], db)
+	require.NoError(t, err)
+	require.NoError(t, rollback.SetRootHash(roots[1]))
+
+	value, err = NewTrie(db).Get([]byte("key-7"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("value-1-7"), value)
+
+	// an empty root opens an empty trie, an unknown one is rejected
+	empty, err := NewTrieAt(nil, db)
+	require.NoError(t, err)
+
+	_, err = empty.Get([]byte("key-7"))
+	require.ErrorIs(t, err, ErrKeyNotFound)
+
+	_, err = NewTrieAt(bytes.Repeat([]byte{1}, 32), db)
+	require.ErrorIs(t, err, errRootNotFound)
+}
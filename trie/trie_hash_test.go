@@ -2,11 +2,15 @@ package trie
 
 import (
 	"bytes"
+	"fmt"
 	"testing"
 
 	mockstorage "github.com/Aleksao998/Merkle-Patricia-Trie/storage/mockStorage"
+	"github.com/Aleksao998/Merkle-Patricia-Trie/storage/mpt"
+	nodes2 "github.com/Aleksao998/Merkle-Patricia-Trie/trie/nodes"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TestInsert tests the insertion of various nodes into the Merkle Patricia Trie (MPT)
@@ -34,7 +38,9 @@ func TestInsert(t *testing.T) {
 	trie.Put([]byte("cat"), []byte("cat1"))
 
 	exp := common.HexToHash("ee85616d8e5799ae1d210f48d4661a9f0287656d8fc552113966a074b6bbf68f")
-	assert.Equal(t, exp.Bytes(), trie.Hash(), "Unexpected root hash after insert operations")
+	root, err := trie.Hash()
+	require.NoError(t, err)
+	assert.Equal(t, exp.Bytes(), root, "Unexpected root hash after insert operations")
 }
 
 // TestDelete tests the deletion of various nodes from the Merkle Patricia Trie (MPT)
@@ -64,13 +70,13 @@ func TestDelete(t *testing.T) {
 
 	exp := common.HexToHash("39430803baabb9d662bd2c25905c6bdf9f5f8e1e2aed6cc1af732554816d55e0")
 
-	assert.Equal(t, exp.Bytes(), trie.Hash(), "Unexpected root hash after delete operations")
+	root, err := trie.Hash()
+	require.NoError(t, err)
+	assert.Equal(t, exp.Bytes(), root, "Unexpected root hash after delete operations")
 }
 
 // TestEmptyTree tests operations on an empty Merkle Patricia Trie (MPT)
-// TODO in go-ethereum it hashes to some value
 func TestEmptyTree(t *testing.T) {
-	t.Skip()
 	t.Parallel()
 
 	db := &mockstorage.MockStorage{}
@@ -78,7 +84,9 @@ func TestEmptyTree(t *testing.T) {
 
 	exp := common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
 
-	root := trie.Hash()
+	root, err := trie.Hash()
+	require.NoError(t, err)
+
 	if !bytes.Equal(root, exp.Bytes()) {
 		t.Errorf("case 1: exp %x got %x", exp, root)
 	}
@@ -106,5 +114,125 @@ func TestSameTries(t *testing.T) {
 	copyTrie.Del([]byte("do"))
 	copyTrie.Put([]byte("dog"), []byte("puppy"))
 
-	assert.Equal(t, trie.Hash(), copyTrie.Hash(), "Tries with same nodes are not identical")
+	root, err := trie.Hash()
+	require.NoError(t, err)
+
+	copyRoot, err := copyTrie.Hash()
+	require.NoError(t, err)
+
+	assert.Equal(t, root, copyRoot, "Tries with same nodes are not identical")
+}
+
+// TestCachedHashes tests that cached hashes are invalidated along the mutated paths,
+// by hashing the trie after every update and comparing it with a trie built from scratch
+func TestCachedHashes(t *testing.T) {
+	t.Parallel()
+
+	trie := NewTrie(mpt.NewMPTMemoryStorage())
+	entries := make(map[string][]byte)
+
+	for i := 0; i < 300; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i*7%101))
+
+		if i%5 == 4 {
+			if _, ok := entries[string(key)]; ok {
+				require.NoError(t, trie.Del(key))
+				delete(entries, string(key))
+			}
+		} else {
+			value := bytes.Repeat([]byte{byte(i)}, i%40+1)
+
+			require.NoError(t, trie.Put(key, value))
+			entries[string(key)] = value
+		}
+
+		if i%50 == 49 {
+			_, err := trie.Commit()
+			require.NoError(t, err)
+		}
+
+		expected := NewTrie(mpt.NewMPTMemoryStorage())
+		for key, value := range entries {
+			require.NoError(t, expected.Put([]byte(key), value))
+		}
+
+		expectedHash, err := expected.Hash()
+		require.NoError(t, err)
+
+		hash, err := trie.Hash()
+		require.NoError(t, err)
+		require.Equal(t, expectedHash, hash, "step %d", i)
+	}
+}
+
+// TestCachedHashesInvalidation tests that a mutation only drops the cached hashes on its path
+func TestCachedHashesInvalidation(t *testing.T) {
+	t.Parallel()
+
+	trie := NewTrie(mpt.NewMPTMemoryStorage())
+
+	for i := 0; i < 16; i++ {
+		require.NoError(t, trie.Put([]byte{byte(i << 4)}, bytes.Repeat([]byte{byte(i)}, 32)))
+	}
+
+	_, err := trie.Hash()
+	require.NoError(t, err)
+
+	root, ok := trie.root.(*nodes2.BranchNode)
+	require.True(t, ok)
+
+	for _, child := range root.Children {
+		require.NotNil(t, nodes2.CacheOf(child).Hash)
+	}
+
+	require.NoError(t, trie.Put([]byte{0x30}, []byte("updated")))
+
+	assert.Nil(t, root.Encoded)
+
+	for i, child := range root.Children {
+		if i == 3 {
+			assert.Nil(t, nodes2.CacheOf(child).Encoded)
+		} else {
+			assert.NotNil(t, nodes2.CacheOf(child).Encoded)
+		}
+	}
+}
+
+// TestHashDoesNotLoadCommittedNodes tests that hashing references committed children
+// by their hash instead of loading them from storage
+func TestHashDoesNotLoadCommittedNodes(t *testing.T) {
+	t.Parallel()
+
+	memory := mpt.NewMPTMemoryStorage()
+	reads := 0
+	db := &mockstorage.MockStorage{
+		HasFn: memory.Has,
+		PutFn: memory.Put,
+		GetFn: func(key []byte) ([]byte, error) {
+			reads++
+
+			return memory.Get(key)
+		},
+	}
+
+	trie := NewTrie(db)
+
+	for i := 0; i < 200; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		trie.Put(key, bytes.Repeat(key, 5))
+	}
+
+	rootKey, err := trie.Commit()
+	require.NoError(t, err)
+
+	hash, err := trie.Hash()
+	require.NoError(t, err)
+	assert.Equal(t, rootKey, hash)
+	assert.Zero(t, reads)
+
+	// a reloaded trie only loads its root pointer and root node
+	hash, err = NewTrie(db).Hash()
+	require.NoError(t, err)
+	assert.Equal(t, rootKey, hash)
+	assert.Equal(t, 2, reads)
 }
@@ -7,6 +7,7 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	ethereumTrie "github.com/ethereum/go-ethereum/trie"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TestProofVerification tests the MPT's proof generation and verification mechanism
@@ -36,7 +37,10 @@ func TestProofVerification(t *testing.T) {
 
 	assert.Nil(t, err, "Failed to generate proof")
 
-	hashByte := common.BytesToHash(trie.Hash())
+	rootHash, err := trie.Hash()
+	require.NoError(t, err)
+
+	hashByte := common.BytesToHash(rootHash)
 
 	value, err := ethereumTrie.VerifyProof(hashByte, keyToProof, proof)
 
@@ -62,7 +66,10 @@ func TestProofVerificationForNonExistentKey(t *testing.T) {
 
 	assert.Error(t, err)
 
-	hashByte := common.BytesToHash(trie.Hash())
+	rootHash, err := trie.Hash()
+	require.NoError(t, err)
+
+	hashByte := common.BytesToHash(rootHash)
 
 	_, err = ethereumTrie.VerifyProof(hashByte, key, proof)
 	assert.NotNil(t, err, "Proof verification should have failed for a non-existent key")
@@ -87,7 +94,10 @@ func TestProofVerificationForOverwrittenKey(t *testing.T) {
 	proof, err := trie.Proof(key)
 	assert.Nil(t, err, "Failed to generate proof")
 
-	hashByte := common.BytesToHash(trie.Hash())
+	rootHash, err := trie.Hash()
+	require.NoError(t, err)
+
+	hashByte := common.BytesToHash(rootHash)
 	value, err := ethereumTrie.VerifyProof(hashByte, key, proof)
 
 	assert.Nil(t, err, "Proof verification failed")
@@ -112,7 +122,10 @@ func TestProofVerificationAfterDeletion(t *testing.T) {
 	proof, err := trie.Proof(key)
 	assert.Error(t, err)
 
-	hashByte := common.BytesToHash(trie.Hash())
+	rootHash, err := trie.Hash()
+	require.NoError(t, err)
+
+	hashByte := common.BytesToHash(rootHash)
 
 	_, err = ethereumTrie.VerifyProof(hashByte, key, proof)
 	assert.NotNil(t, err, "Proof verification should have failed for a deleted key")
@@ -131,7 +144,7 @@ func TestProofVerificationForNonExistentKeyInLeaf(t *testing.T) {
 	nonExistentKey := []byte("nonexistent")
 	_, err := trie.Proof(nonExistentKey)
 
-	assert.ErrorIs(t, err, errKeyNotFound, "Expected key not found error for non-existent key in leaf node")
+	assert.ErrorIs(t, err, ErrKeyNotFound, "Expected key not found error for non-existent key in leaf node")
 }
 
 // TestProofVerificationForNonExistentKeyInBranch tests that a proof cannot be generated
@@ -156,7 +169,7 @@ func TestProofVerificationForNonExistentKeyInBranch(t *testing.T) {
 	nonExistentKey := []byte("cat")
 	_, err := trie.Proof(nonExistentKey)
 
-	assert.ErrorIs(t, err, errKeyNotFound, "Expected key not found error for non-existent key in branch node")
+	assert.ErrorIs(t, err, ErrKeyNotFound, "Expected key not found error for non-existent key in branch node")
 }
 
 // TestProofVerificationForNonExistentKeyInExtension tests that a proof cannot be generated
@@ -175,7 +188,7 @@ func TestProofVerificationForNonExistentKeyInExtension(t *testing.T) {
 	nonExistentKey := []byte("dogx")
 	_, err := trie.Proof(nonExistentKey)
 
-	assert.ErrorIs(t, err, errKeyNotFound, "Expected key not found error for non-existent key in extension node")
+	assert.ErrorIs(t, err, ErrKeyNotFound, "Expected key not found error for non-existent key in extension node")
 }
 
 // TestProofVerificationForNonExistentKeyInHash tests that a proof cannot be generated
@@ -196,5 +209,5 @@ func TestProofVerificationForNonExistentKeyInHash(t *testing.T) {
 	nonExistentKey := []byte("overwrittenNotMe")
 	_, err := trie.Proof(nonExistentKey)
 
-	assert.ErrorIs(t, err, errKeyNotFound, "Expected key not found error for non-existent key in hash node")
+	assert.ErrorIs(t, err, ErrKeyNotFound, "Expected key not found error for non-existent key in hash node")
 }
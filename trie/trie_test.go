@@ -1,11 +1,13 @@
 package trie
 
 import (
+	"errors"
 	"strconv"
 	"sync"
 	"testing"
 
 	mockstorage "github.com/Aleksao998/Merkle-Patricia-Trie/storage/mockStorage"
+	"github.com/Aleksao998/Merkle-Patricia-Trie/storage/mpt"
 	"github.com/stretchr/testify/require"
 )
 
@@ -20,10 +22,10 @@ func TestGetPutDelBasic(t *testing.T) {
 		trie := NewTrie(db)
 
 		_, err := trie.Get([]byte("notexist"))
-		require.Error(t, errKeyNotFound, err)
+		require.Error(t, ErrKeyNotFound, err)
 
 		err = trie.Del([]byte("notexist"))
-		require.Error(t, errKeyNotFound, err)
+		require.Error(t, ErrKeyNotFound, err)
 	})
 
 	t.Run("should get an value if key exists", func(t *testing.T) {
@@ -49,7 +51,7 @@ func TestGetPutDelBasic(t *testing.T) {
 		trie.Del([]byte("key"))
 
 		_, err := trie.Get([]byte("notexist"))
-		require.Error(t, errKeyNotFound, err)
+		require.Error(t, ErrKeyNotFound, err)
 	})
 
 	t.Run("should get latest value on updated items", func(t *testing.T) {
@@ -241,3 +243,135 @@ func TestTrieConcurrencyAdvance(t *testing.T) {
 	// wait for all goroutines to finish
 	wg.Wait()
 }
+
+// TestStorageErrorsArePropagated tests that storage failures are returned to the caller instead of panicking
+func TestStorageErrorsArePropagated(t *testing.T) {
+	t.Parallel()
+
+	errStorage := errors.New("storage unavailable")
+
+	t.Run("commit should return an error if storage write fails", func(t *testing.T) {
+		t.Parallel()
+
+		db := &mockstorage.MockStorage{
+			PutFn: func(key []byte, value []byte) error {
+				return errStorage
+			},
+		}
+		trie := NewTrie(db)
+
+		require.NoError(t, trie.Put([]byte("key"), []byte("value")))
+
+		_, err := trie.Commit()
+		require.ErrorIs(t, err, errStorage)
+	})
+
+	t.Run("put should return an error if a hash node cannot be loaded", func(t *testing.T) {
+		t.Parallel()
+
+		db := mpt.NewMPTMemoryStorage()
+		trie := NewTrie(db)
+
+		require.NoError(t, trie.Put([]byte("dog"), []byte("dog")))
+		require.NoError(t, trie.Put([]byte("dor"), []byte("dor")))
+
+		_, err := trie.Commit()
+		require.NoError(t, err)
+
+		failing := &mockstorage.MockStorage{
+			HasFn: db.Has,
+			GetFn: func(key []byte) ([]byte, error) {
+				if string(key) == rootHashKey {
+					return db.Get(key)
+				}
+
+				return nil, errStorage
+			},
+		}
+
+		require.ErrorIs(t, NewTrie(failing).Put([]byte("cat"), []byte("cat")), errStorage)
+
+		_, err = NewTrie(failing).Hash()
+		require.ErrorIs(t, err, errStorage)
+	})
+}
+
+// TestTrieConcurrentGetCommitted tests reading a committed trie in parallel,
+// which loads the root and the stored nodes from storage
+func TestTrieConcurrentGetCommitted(t *testing.T) {
+	t.Parallel()
+
+	db := mpt.NewMPTMemoryStorage()
+	trie := NewTrie(db)
+
+	for i := 0; i < 200; i++ {
+		require.NoError(t, trie.Put([]byte("key"+strconv.Itoa(i)), []byte("value"+strconv.Itoa(i))))
+	}
+
+	_, err := trie.Commit()
+	require.NoError(t, err)
+
+	for _, reader := range []*Trie{trie, NewTrie(db)} {
+		var wg sync.WaitGroup
+
+		for i := 0; i < 200; i++ {
+			wg.Add(1)
+
+			go func(i int) {
+				defer wg.Done()
+
+				value, err := reader.Get([]byte("key" + strconv.Itoa(i)))
+				require.NoError(t, err)
+				require.Equal(t, "value"+strconv.Itoa(i), string(value))
+			}(i)
+		}
+
+		wg.Wait()
+	}
+}
+
+// TestDeleteLeavesCanonicalTrie tests that deleting keys gives the same root as inserting
+// only the remaining keys, also when a branch node is left holding only its value
+func TestDeleteLeavesCanonicalTrie(t *testing.T) {
+	t.Parallel()
+
+	keys := []string{"", "a", "ab", "abc", "abd", "b", "ba", "bb", "c"}
+
+	for _, deleted := range [][]string{
+		{"ab"},
+		{"abc", "abd"},
+		{"ba", "bb"},
+		{"a", "abc", "abd", "b"},
+		{"", "c", "ba"},
+	} {
+		trie := NewTrie(mpt.NewMPTMemoryStorage())
+		expected := NewTrie(mpt.NewMPTMemoryStorage())
+
+		for _, key := range keys {
+			require.NoError(t, trie.Put([]byte(key), []byte("value-"+key)))
+		}
+
+		remaining := make(map[string]bool)
+		for _, key := range keys {
+			remaining[key] = true
+		}
+
+		for _, key := range deleted {
+			require.NoError(t, trie.Del([]byte(key)))
+			delete(remaining, key)
+		}
+
+		for _, key := range keys {
+			if remaining[key] {
+				require.NoError(t, expected.Put([]byte(key), []byte("value-"+key)))
+			}
+		}
+
+		expectedRoot, err := expected.Hash()
+		require.NoError(t, err)
+
+		root, err := trie.Hash()
+		require.NoError(t, err)
+		require.Equal(t, expectedRoot, root, "deleted %q", deleted)
+	}
+}
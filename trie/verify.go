@@ -0,0 +1,74 @@
+package trie
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Aleksao998/Merkle-Patricia-Trie/storage"
+	"github.com/Aleksao998/Merkle-Patricia-Trie/trie/nibble"
+	nodes2 "github.com/Aleksao998/Merkle-Patricia-Trie/trie/nodes"
+)
+
+var (
+	// ErrKeyAbsent is returned when a proof is valid and shows that the key is not in the trie
+	ErrKeyAbsent = errors.New("key is absent from the trie")
+
+	// ErrInvalidProof is returned when a proof is malformed or does not lead to the root hash
+	ErrInvalidProof = errors.New("invalid proof")
+)
+
+// VerifyProof checks a Merkle-proof of the key against the root hash and returns the proven value.
+// Every proof node is looked up by its hash and checked against it before it is decoded.
+// ErrKeyAbsent is returned if the proof shows the key is not in the trie,
+// and ErrInvalidProof if the proof cannot be trusted
+func VerifyProof(rootHash []byte, key []byte, proof storage.Storage) ([]byte, error) {
+	// an empty trie holds no keys
+	if isEmptyRoot(rootHash) {
+		return nil, ErrKeyAbsent
+	}
+
+	nibblePath := nibble.FromBytes(key)
+
+	var currentNode nodes2.Node = nodes2.NewHashNode(rootHash)
+
+	for {
+		switch node := currentNode.(type) {
+		case nil:
+			return nil, ErrKeyAbsent
+		case *nodes2.HashNode:
+			actualNode, err := verifiedProofNode(proof, node.Hash)
+			if err != nil {
+				return nil, err
+			}
+
+			currentNode = actualNode
+		case *nodes2.LeafNode:
+			if !nibble.Equal(node.Path, nibblePath) {
+				return nil, ErrKeyAbsent
+			}
+
+			return node.Value, nil
+		case *nodes2.ExtensionNode:
+			if nibble.CommonPrefixLength(node.Path, nibblePath) < len(node.Path) {
+				return nil, ErrKeyAbsent
+			}
+
+			nibblePath = nibblePath[len(node.Path):]
+			currentNode = node.Node
+		case *nodes2.BranchNode:
+			if len(nibblePath) == 0 {
+				value, found := node.GetValue()
+				if !found {
+					return nil, ErrKeyAbsent
+				}
+
+				return value, nil
+			}
+
+			currentNode = node.Children[nibblePath[0]]
+			nibblePath = nibblePath[1:]
+		default:
+			return nil, fmt.Errorf("%w: %T", errUnexpectedNode, node)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package trie
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Aleksao998/Merkle-Patricia-Trie/storage/mpt"
+	"github.com/ethereum/go-ethereum/common"
+	ethereumTrie "github.com/ethereum/go-ethereum/trie"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newProofTestTrie returns a trie with keys forming leaf, extension and branch nodes
+func newProofTestTrie(t *testing.T) (*Trie, map[string][]byte) {
+	t.Helper()
+
+	entries := map[string][]byte{
+		"do":           bytes.Repeat([]byte("v"), 40),
+		"dog":          bytes.Repeat([]byte("p"), 40),
+		"doge":         bytes.Repeat([]byte("c"), 40),
+		"dogglesworth": bytes.Repeat([]byte("w"), 40),
+		"horse":        bytes.Repeat([]byte("s"), 40),
+	}
+
+	trie := NewTrie(mpt.NewMPTMemoryStorage())
+
+	for key, value := range entries {
+		require.NoError(t, trie.Put([]byte(key), value))
+	}
+
+	return trie, entries
+}
+
+// TestVerifyProofInclusion tests that the native verifier returns the proven value
+// and agrees with the go-ethereum implementation, before and after commit
+func TestVerifyProofInclusion(t *testing.T) {
+	t.Parallel()
+
+	trie, entries := newProofTestTrie(t)
+
+	for _, committed := range []bool{false, true} {
+		if committed {
+			_, err := trie.Commit()
+			require.NoError(t, err)
+		}
+
+		root, err := trie.Hash()
+		require.NoError(t, err)
+
+		for key, expected := range entries {
+			proof, err := trie.Proof([]byte(key))
+			require.NoError(t, err)
+
+			value, err := VerifyProof(root, []byte(key), proof)
+			require.NoError(t, err)
+			assert.Equal(t, expected, value)
+
+			ethValue, err := ethereumTrie.VerifyProof(common.BytesToHash(root), []byte(key), proof)
+			require.NoError(t, err)
+			assert.Equal(t, ethValue, value)
+		}
+	}
+}
+
+// TestVerifyProofAbsence tests that a valid proof for a missing key is reported as a proven absence
+func TestVerifyProofAbsence(t *testing.T) {
+	t.Parallel()
+
+	trie, _ := newProofTestTrie(t)
+
+	root, err := trie.Hash()
+	require.NoError(t, err)
+
+	// diverging leaf path, empty branch slot and diverging extension
+	for _, key := range []string{"dogs", "cat", "dx", "d"} {
+		proof, err := trie.Proof([]byte(key))
+		require.ErrorIs(t, err, ErrKeyNotFound)
+
+		_, err = VerifyProof(root, []byte(key), proof)
+		assert.ErrorIs(t, err, ErrKeyAbsent, key)
+	}
+
+	_, err = VerifyProof(nil, []byte("dog"), mpt.NewMPTMemoryStorage())
+	assert.ErrorIs(t, err, ErrKeyAbsent)
+}
+
+// TestVerifyProofInvalid tests that incomplete or tampered proofs are rejected
+func TestVerifyProofInvalid(t *testing.T) {
+	t.Parallel()
+
+	trie, _ := newProofTestTrie(t)
+
+	root, err := trie.Hash()
+	require.NoError(t, err)
+
+	t.Run("wrong root", func(t *testing.T) {
+		t.Parallel()
+
+		proof, err := trie.Proof([]byte("dog"))
+		require.NoError(t, err)
+
+		_, err = VerifyProof(bytes.Repeat([]byte{1}, 32), []byte("dog"), proof)
+		assert.ErrorIs(t, err, ErrInvalidProof)
+	})
+
+	t.Run("missing node", func(t *testing.T) {
+		t.Parallel()
+
+		proof, err := trie.Proof([]byte("horse"))
+		require.NoError(t, err)
+
+		_, err = VerifyProof(root, []byte("dogglesworth"), proof)
+		assert.ErrorIs(t, err, ErrInvalidProof)
+	})
+
+	t.Run("tampered node", func(t *testing.T) {
+		t.Parallel()
+
+		proof, err := trie.Proof([]byte("dog"))
+		require.NoError(t, err)
+
+		rootNode, err := proof.Get(root)
+		require.NoError(t, err)
+
+		tampered := append([]byte{}, rootNode...)
+		tampered[len(tampered)-1] ^= 0xff
+
+		require.NoError(t, proof.Put(root, tampered))
+
+		_, err = VerifyProof(root, []byte("dog"), proof)
+		assert.ErrorIs(t, err, ErrInvalidProof)
+	})
+}